@@ -0,0 +1,36 @@
+package httpretry
+
+import (
+	"strconv"
+	"time"
+)
+
+const (
+	// DefaultAttemptHeader is the header that is used by WithAttemptHeader if no header name is given
+	DefaultAttemptHeader = "X-Retry-Count"
+)
+
+// AttemptHeaderFormatter formats the value of the attempt header.
+//
+// The attemptCount starts with 1 for the first attempt, firstSent is the time the first attempt was sent.
+type AttemptHeaderFormatter func(attemptCount int, firstSent time.Time) string
+
+var (
+	// FormatRetryCount formats the number of retries, i.e. "0" for the first attempt, "1" for the first retry.
+	FormatRetryCount AttemptHeaderFormatter = func(attemptCount int, _ time.Time) string {
+		return strconv.Itoa(attemptCount - 1)
+	}
+
+	// FormatAttemptCount formats the number of the attempt, i.e. "1" for the first attempt, "2" for the first retry.
+	FormatAttemptCount AttemptHeaderFormatter = func(attemptCount int, _ time.Time) string {
+		return strconv.Itoa(attemptCount)
+	}
+
+	// FormatAttemptWithTimestamp formats the number of the attempt and the time the first attempt was sent.
+	//
+	// Example:
+	//   attempt=2; sent=2006-01-02T15:04:05.999Z
+	FormatAttemptWithTimestamp AttemptHeaderFormatter = func(attemptCount int, firstSent time.Time) string {
+		return "attempt=" + strconv.Itoa(attemptCount) + "; sent=" + firstSent.UTC().Format(time.RFC3339Nano)
+	}
+)
@@ -11,9 +11,15 @@ import (
 // The backoff can be calculated by taking the current number of retries into consideration.
 type BackoffPolicy func(attemptCount int) time.Duration
 
+const (
+	defaultMinWait   = 1 * time.Second
+	defaultMaxWait   = 30 * time.Second
+	defaultMaxJitter = 200 * time.Millisecond
+)
+
 var (
 	// defaultBackoffPolicy uses ExponentialBackoff with 1 second minWait, 30 seconds max wait and 200ms jitter
-	defaultBackoffPolicy = ExponentialBackoff(1*time.Second, 30*time.Second, 200*time.Millisecond)
+	defaultBackoffPolicy = ExponentialBackoff(defaultMinWait, defaultMaxWait, defaultMaxJitter)
 
 	// ConstantBackoff waits for the exact same duration after a failed retry.
 	//
@@ -97,15 +103,101 @@ var (
 			maxWait = 0
 		}
 		return func(attemptCount int) time.Duration {
-			nextWait := time.Duration(math.Pow(2, float64(attemptCount-1)))*minWait + randJitter(maxJitter)
+			nextWait := addDuration(exponentialWait(minWait, 2, attemptCount), randJitter(maxJitter))
 			if maxWait > 0 {
 				return minDuration(nextWait, maxWait)
 			}
 			return nextWait
 		}
 	}
+
+	// MultiplierBackoff increases the backoff exponentially by multiplying the minWait with multiplier^(attemptCount-1)
+	// and randomizes the result by a fraction of the calculated wait (like the Google HTTP client does).
+	//
+	// minWait: the initial backoff
+	//
+	// maxWait: sets an upper bound on the (not randomized) backoff. set to 0 for no upper bound
+	//
+	// multiplier: the factor the backoff grows by with every attempt. values < 1 are treated as 1
+	//
+	// randomizationFactor: the backoff is randomized in the interval [wait - randomizationFactor*wait, wait + randomizationFactor*wait].
+	// values are clamped to [0, 1]
+	//
+	// The calculation saturates instead of overflowing, so a large attemptCount never results in a negative backoff.
+	//
+	// Example:
+	//   minWait = 1 * time.Seconds
+	//   maxWait = 10 * time.Seconds
+	//   multiplier = 1.5
+	//   randomizationFactor = 0
+	//
+	//   Backoff will be: 1, 1.5, 2.25, 3.375, 5.0625, 7.59375, 10, 10, ...
+	MultiplierBackoff = func(minWait time.Duration, maxWait time.Duration, multiplier float64, randomizationFactor float64) BackoffPolicy {
+		if minWait < 0 {
+			minWait = 0
+		}
+		if maxWait < minWait {
+			maxWait = 0
+		}
+		if multiplier < 1 || math.IsNaN(multiplier) {
+			multiplier = 1
+		}
+		if randomizationFactor < 0 || math.IsNaN(randomizationFactor) {
+			randomizationFactor = 0
+		}
+		if randomizationFactor > 1 {
+			randomizationFactor = 1
+		}
+		return func(attemptCount int) time.Duration {
+			nextWait := exponentialWait(minWait, multiplier, attemptCount)
+			if maxWait > 0 {
+				nextWait = minDuration(nextWait, maxWait)
+			}
+			return randomize(nextWait, randomizationFactor)
+		}
+	}
 )
 
+// maxDuration is the largest representable duration, used to saturate backoff calculations
+const maxDuration = time.Duration(math.MaxInt64)
+
+// exponentialWait returns minWait * multiplier^(attemptCount-1), saturated at maxDuration.
+//
+// if attemptCount is < 1, a duration of 0 is returned
+func exponentialWait(minWait time.Duration, multiplier float64, attemptCount int) time.Duration {
+	if attemptCount < 1 || minWait <= 0 {
+		return 0
+	}
+
+	wait := float64(minWait) * math.Pow(multiplier, float64(attemptCount-1))
+	if wait >= float64(maxDuration) {
+		return maxDuration
+	}
+	return time.Duration(wait)
+}
+
+// addDuration returns the sum of two non-negative durations, saturated at maxDuration.
+func addDuration(duration1 time.Duration, duration2 time.Duration) time.Duration {
+	if duration1 > maxDuration-duration2 {
+		return maxDuration
+	}
+	return duration1 + duration2
+}
+
+// randomize returns a random duration in the interval [wait - factor*wait, wait + factor*wait], saturated at maxDuration.
+func randomize(wait time.Duration, factor float64) time.Duration {
+	if wait <= 0 || factor <= 0 {
+		return wait
+	}
+
+	delta := factor * float64(wait)
+	randomized := float64(wait) - delta + rand.Float64()*(2*delta)
+	if randomized >= float64(maxDuration) {
+		return maxDuration
+	}
+	return time.Duration(randomized)
+}
+
 // minDuration returns the minimum of two durations
 func minDuration(duration1 time.Duration, duration2 time.Duration) time.Duration {
 	if duration1 < duration2 {
@@ -0,0 +1,192 @@
+package httpretry
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// ResponseBackoffPolicy is used to calculate the time to wait, before executing another request.
+//
+// In contrast to BackoffPolicy it also receives the last response, which may be nil (e.g. in case of a request error).
+type ResponseBackoffPolicy func(attemptCount int, resp *http.Response) time.Duration
+
+// Max returns a BackoffPolicy that waits for the maximum backoff of all provided policies.
+//
+// If no policy is provided, the backoff will always be 0.
+func Max(policies ...BackoffPolicy) BackoffPolicy {
+	return func(attemptCount int) time.Duration {
+		var wait time.Duration
+		for i, policy := range policies {
+			nextWait := policy(attemptCount)
+			if i == 0 || nextWait > wait {
+				wait = nextWait
+			}
+		}
+		return wait
+	}
+}
+
+// Min returns a BackoffPolicy that waits for the minimum backoff of all provided policies.
+//
+// If no policy is provided, the backoff will always be 0.
+func Min(policies ...BackoffPolicy) BackoffPolicy {
+	return func(attemptCount int) time.Duration {
+		var wait time.Duration
+		for i, policy := range policies {
+			nextWait := policy(attemptCount)
+			if i == 0 || nextWait < wait {
+				wait = nextWait
+			}
+		}
+		return wait
+	}
+}
+
+// Sum returns a BackoffPolicy that waits for the sum of the backoffs of all provided policies.
+//
+// The sum saturates instead of overflowing.
+func Sum(policies ...BackoffPolicy) BackoffPolicy {
+	return func(attemptCount int) time.Duration {
+		var wait time.Duration
+		for _, policy := range policies {
+			wait = addDuration(wait, nonNegative(policy(attemptCount)))
+		}
+		return wait
+	}
+}
+
+// Cap limits the backoff of the provided policy to maxWait.
+//
+// Example:
+//
+//	Cap(ExponentialBackoff(1*time.Second, 0, 0), 5*time.Second)
+//
+//	Backoff will be: 1, 2, 4, 5, 5, ...
+func Cap(policy BackoffPolicy, maxWait time.Duration) BackoffPolicy {
+	if maxWait < 0 {
+		maxWait = 0
+	}
+	return func(attemptCount int) time.Duration {
+		return minDuration(policy(attemptCount), maxWait)
+	}
+}
+
+// WithJitterFraction randomizes the backoff of the provided policy by a fraction of the calculated wait.
+//
+// The backoff is randomized in the interval [wait - fraction*wait, wait + fraction*wait].
+// fraction is clamped to [0, 1].
+func WithJitterFraction(policy BackoffPolicy, fraction float64) BackoffPolicy {
+	if fraction < 0 || math.IsNaN(fraction) {
+		fraction = 0
+	}
+	if fraction > 1 {
+		fraction = 1
+	}
+	return func(attemptCount int) time.Duration {
+		return randomize(policy(attemptCount), fraction)
+	}
+}
+
+// Sequence waits for the provided fixed durations first and hands over to the fallback policy afterwards.
+//
+// The fallback receives the attemptCount relative to the end of the sequence (starting with 1),
+// so an exponential fallback starts with its minWait.
+// If fallback is nil, the last fixed duration is repeated.
+//
+// Example (first retry immediate, then exponential capped at 10s):
+//
+//	Sequence([]time.Duration{0}, Cap(ExponentialBackoff(1*time.Second, 0, 0), 10*time.Second))
+//
+//	Backoff will be: 0, 1, 2, 4, 8, 10, 10, ...
+func Sequence(durations []time.Duration, fallback BackoffPolicy) BackoffPolicy {
+	durations = append([]time.Duration(nil), durations...)
+	return func(attemptCount int) time.Duration {
+		switch {
+		case attemptCount < 1:
+			return 0
+		case attemptCount <= len(durations):
+			return durations[attemptCount-1]
+		case fallback != nil:
+			return fallback(attemptCount - len(durations))
+		case len(durations) > 0:
+			return durations[len(durations)-1]
+		default:
+			return 0
+		}
+	}
+}
+
+// FromRetryAfter waits for the duration the server requested with the Retry-After header of the last response.
+//
+// If the last response does not provide a valid Retry-After header, the fallback policy is used,
+// or no backoff at all if fallback is nil.
+//
+// The requested duration is not limited, so a single response may block the client for a very long time.
+// Wrap the policy with CapResponse() to bound the wait.
+//
+// Use WithResponseBackoffPolicy() to set it on the retry roundtripper.
+//
+// Example:
+//
+//	CapResponse(FromRetryAfter(ExponentialBackoff(1*time.Second, 30*time.Second, 0)), 2*time.Minute)
+func FromRetryAfter(fallback BackoffPolicy) ResponseBackoffPolicy {
+	return func(attemptCount int, resp *http.Response) time.Duration {
+		if wait, ok := retryAfter(resp); ok {
+			return wait
+		}
+		if fallback == nil {
+			return 0
+		}
+		return fallback(attemptCount)
+	}
+}
+
+// CapResponse limits the backoff of the provided response policy to maxWait.
+func CapResponse(policy ResponseBackoffPolicy, maxWait time.Duration) ResponseBackoffPolicy {
+	if maxWait < 0 {
+		maxWait = 0
+	}
+	return func(attemptCount int, resp *http.Response) time.Duration {
+		return minDuration(policy(attemptCount, resp), maxWait)
+	}
+}
+
+// retryAfter parses the Retry-After header of the response.
+//
+// The header may either contain the number of seconds to wait or a http date.
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	if resp == nil {
+		return 0, false
+	}
+
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		if seconds > int64(maxDuration/time.Second) {
+			return maxDuration, true
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		return nonNegative(time.Until(date)), true
+	}
+
+	return 0, false
+}
+
+// nonNegative returns the duration or 0 if it is negative
+func nonNegative(duration time.Duration) time.Duration {
+	if duration < 0 {
+		return 0
+	}
+	return duration
+}
@@ -0,0 +1,150 @@
+package httpretry_test
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/ybbus/httpretry"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestBackoffCombinators(t *testing.T) {
+	check := assert.New(t)
+
+	constant1 := httpretry.ConstantBackoff(1*time.Second, 0)
+	linear := httpretry.LinearBackoff(1*time.Second, 0, 0)
+
+	t.Run("Max should return the maximum backoff", func(t *testing.T) {
+		backoff := httpretry.Max(httpretry.ConstantBackoff(2*time.Second, 0), linear)
+
+		check.Equal(2*time.Second, backoff(1))
+		check.Equal(2*time.Second, backoff(2))
+		check.Equal(3*time.Second, backoff(3))
+	})
+
+	t.Run("Min should return the minimum backoff", func(t *testing.T) {
+		backoff := httpretry.Min(httpretry.ConstantBackoff(2*time.Second, 0), linear)
+
+		check.Equal(1*time.Second, backoff(1))
+		check.Equal(2*time.Second, backoff(2))
+		check.Equal(2*time.Second, backoff(3))
+	})
+
+	t.Run("Max and Min should return 0 without policies", func(t *testing.T) {
+		check.Equal(time.Duration(0), httpretry.Max()(1))
+		check.Equal(time.Duration(0), httpretry.Min()(1))
+	})
+
+	t.Run("Sum should add all backoffs", func(t *testing.T) {
+		backoff := httpretry.Sum(constant1, linear)
+
+		check.Equal(2*time.Second, backoff(1))
+		check.Equal(3*time.Second, backoff(2))
+		check.Equal(4*time.Second, backoff(3))
+	})
+
+	t.Run("Sum should saturate", func(t *testing.T) {
+		huge := httpretry.ExponentialBackoff(1*time.Second, 0, 0)
+		backoff := httpretry.Sum(huge, huge)
+
+		check.Greater(backoff(1000), time.Duration(0))
+	})
+
+	t.Run("Cap should limit backoff", func(t *testing.T) {
+		backoff := httpretry.Cap(httpretry.ExponentialBackoff(1*time.Second, 0, 0), 5*time.Second)
+
+		check.Equal(1*time.Second, backoff(1))
+		check.Equal(2*time.Second, backoff(2))
+		check.Equal(4*time.Second, backoff(3))
+		check.Equal(5*time.Second, backoff(4))
+		check.Equal(5*time.Second, backoff(1000))
+	})
+
+	t.Run("WithJitterFraction should randomize in correct interval", func(t *testing.T) {
+		backoff := httpretry.WithJitterFraction(httpretry.ConstantBackoff(10*time.Second, 0), 0.2)
+
+		for i := 0; i < 100; i++ {
+			probe := backoff(1)
+			check.GreaterOrEqual(probe, 8*time.Second)
+			check.LessOrEqual(probe, 12*time.Second)
+		}
+	})
+
+	t.Run("WithJitterFraction should not randomize on fraction <= 0", func(t *testing.T) {
+		backoff := httpretry.WithJitterFraction(constant1, -1)
+
+		check.Equal(1*time.Second, backoff(1))
+	})
+
+	t.Run("Sequence should use fixed durations first, then fallback", func(t *testing.T) {
+		backoff := httpretry.Sequence([]time.Duration{0}, httpretry.Cap(httpretry.ExponentialBackoff(1*time.Second, 0, 0), 10*time.Second))
+
+		check.Equal(0*time.Second, backoff(1))
+		check.Equal(1*time.Second, backoff(2))
+		check.Equal(2*time.Second, backoff(3))
+		check.Equal(4*time.Second, backoff(4))
+		check.Equal(8*time.Second, backoff(5))
+		check.Equal(10*time.Second, backoff(6))
+	})
+
+	t.Run("Sequence should repeat last duration without fallback", func(t *testing.T) {
+		backoff := httpretry.Sequence([]time.Duration{1 * time.Second, 3 * time.Second}, nil)
+
+		check.Equal(1*time.Second, backoff(1))
+		check.Equal(3*time.Second, backoff(2))
+		check.Equal(3*time.Second, backoff(3))
+		check.Equal(0*time.Second, httpretry.Sequence(nil, nil)(1))
+	})
+}
+
+func TestFromRetryAfter(t *testing.T) {
+	check := assert.New(t)
+
+	backoff := httpretry.FromRetryAfter(httpretry.ConstantBackoff(1*time.Second, 0))
+
+	responseWithRetryAfter := func(value string) *http.Response {
+		return &http.Response{Header: http.Header{"Retry-After": []string{value}}}
+	}
+
+	t.Run("should use fallback if there is no response", func(t *testing.T) {
+		check.Equal(1*time.Second, backoff(1, nil))
+	})
+
+	t.Run("should not wait without fallback if header is missing", func(t *testing.T) {
+		check.Equal(time.Duration(0), httpretry.FromRetryAfter(nil)(1, nil))
+		check.Equal(7*time.Second, httpretry.FromRetryAfter(nil)(1, responseWithRetryAfter("7")))
+	})
+
+	t.Run("should cap requested duration", func(t *testing.T) {
+		capped := httpretry.CapResponse(backoff, 1*time.Minute)
+
+		check.Equal(1*time.Minute, capped(1, responseWithRetryAfter("99999999999")))
+		check.Equal(7*time.Second, capped(1, responseWithRetryAfter("7")))
+		check.Equal(1*time.Second, capped(1, nil))
+	})
+
+	t.Run("should use fallback if header is missing or invalid", func(t *testing.T) {
+		check.Equal(1*time.Second, backoff(1, &http.Response{Header: http.Header{}}))
+		check.Equal(1*time.Second, backoff(1, responseWithRetryAfter("soon")))
+		check.Equal(1*time.Second, backoff(1, responseWithRetryAfter("-5")))
+	})
+
+	t.Run("should use seconds from header", func(t *testing.T) {
+		check.Equal(7*time.Second, backoff(1, responseWithRetryAfter("7")))
+		check.Equal(0*time.Second, backoff(1, responseWithRetryAfter("0")))
+	})
+
+	t.Run("should use http date from header", func(t *testing.T) {
+		date := time.Now().Add(1 * time.Hour).UTC().Format(http.TimeFormat)
+		wait := backoff(1, responseWithRetryAfter(date))
+
+		check.Greater(wait, 58*time.Minute)
+		check.LessOrEqual(wait, 1*time.Hour)
+	})
+
+	t.Run("should not wait for http date in the past", func(t *testing.T) {
+		date := time.Now().Add(-1 * time.Hour).UTC().Format(http.TimeFormat)
+
+		check.Equal(0*time.Second, backoff(1, responseWithRetryAfter(date)))
+	})
+}
@@ -3,6 +3,7 @@ package httpretry_test
 import (
 	"github.com/stretchr/testify/assert"
 	"github.com/ybbus/httpretry"
+	"math"
 	"testing"
 	"time"
 )
@@ -222,3 +223,87 @@ func TestExponentialBackoff(t *testing.T) {
 		check.Equal(8*time.Second, backoffJitterNegativ(4))
 	})
 }
+
+func TestExponentialBackoffOverflow(t *testing.T) {
+	check := assert.New(t)
+
+	t.Run("backoff should saturate instead of overflowing without maxWait", func(t *testing.T) {
+		backoff := httpretry.ExponentialBackoff(1*time.Second, 0, 0)
+
+		check.Equal(time.Duration(math.MaxInt64), backoff(64))
+		check.Equal(time.Duration(math.MaxInt64), backoff(1000))
+	})
+
+	t.Run("backoff should saturate with jitter", func(t *testing.T) {
+		backoff := httpretry.ExponentialBackoff(1*time.Second, 0, 1*time.Second)
+
+		check.Equal(time.Duration(math.MaxInt64), backoff(1000))
+	})
+
+	t.Run("backoff should respect maxWait for large attempt counts", func(t *testing.T) {
+		backoff := httpretry.ExponentialBackoff(1*time.Second, 30*time.Second, 0)
+
+		check.Equal(30*time.Second, backoff(64))
+		check.Equal(30*time.Second, backoff(1000))
+	})
+}
+
+func TestMultiplierBackoff(t *testing.T) {
+	check := assert.New(t)
+
+	t.Run("backoff should grow by multiplier", func(t *testing.T) {
+		backoff := httpretry.MultiplierBackoff(1*time.Second, 10*time.Second, 1.5, 0)
+
+		check.Equal(1*time.Second, backoff(1))
+		check.Equal(1500*time.Millisecond, backoff(2))
+		check.Equal(2250*time.Millisecond, backoff(3))
+		check.Equal(3375*time.Millisecond, backoff(4))
+		check.Equal(10*time.Second, backoff(10))
+	})
+
+	t.Run("multiplier of 2 should equal ExponentialBackoff", func(t *testing.T) {
+		multiplierBackoff := httpretry.MultiplierBackoff(1*time.Second, 0, 2, 0)
+		exponentialBackoff := httpretry.ExponentialBackoff(1*time.Second, 0, 0)
+
+		for i := 1; i < 100; i++ {
+			check.Equal(exponentialBackoff(i), multiplierBackoff(i))
+		}
+	})
+
+	t.Run("multiplier < 1 should be treated as 1", func(t *testing.T) {
+		backoff := httpretry.MultiplierBackoff(2*time.Second, 0, 0.5, 0)
+
+		check.Equal(2*time.Second, backoff(1))
+		check.Equal(2*time.Second, backoff(2))
+		check.Equal(2*time.Second, backoff(3))
+	})
+
+	t.Run("backoff should saturate instead of overflowing", func(t *testing.T) {
+		backoff := httpretry.MultiplierBackoff(1*time.Second, 0, 1.5, 0.5)
+
+		for _, attempt := range []int{100, 1000, math.MaxInt32} {
+			check.Greater(backoff(attempt), time.Duration(0))
+		}
+	})
+
+	t.Run("randomization should be in correct interval", func(t *testing.T) {
+		backoff := httpretry.MultiplierBackoff(10*time.Second, 0, 2, 0.5)
+
+		for i := 0; i < 100; i++ {
+			probe := backoff(2)
+			check.GreaterOrEqual(probe, 10*time.Second)
+			check.LessOrEqual(probe, 30*time.Second)
+		}
+	})
+
+	t.Run("randomizationFactor should be clamped", func(t *testing.T) {
+		backoffNegativ := httpretry.MultiplierBackoff(1*time.Second, 0, 2, -1)
+		check.Equal(1*time.Second, backoffNegativ(1))
+		check.Equal(2*time.Second, backoffNegativ(2))
+
+		backoffTooLarge := httpretry.MultiplierBackoff(1*time.Second, 0, 2, 5)
+		for i := 0; i < 100; i++ {
+			check.LessOrEqual(backoffTooLarge(2), 4*time.Second)
+		}
+	})
+}
@@ -0,0 +1,105 @@
+package httpretry
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// maxPooledBodyBuffer is the capacity up to which request body buffers are returned to the pool,
+// larger buffers are left to the garbage collector, so a single huge body does not stay in memory.
+const maxPooledBodyBuffer = 4 << 20
+
+// errBodyBufferReleased is returned by GetBody of an attempt, if the request already finished and released its body.
+var errBodyBufferReleased = errors.New("request body buffer was already released")
+
+var bodyBufferPool = sync.Pool{
+	New: func() interface{} { return new(bytes.Buffer) },
+}
+
+// bodyBuffer holds the buffered body of a request that is shared by all attempts.
+//
+// The request and every attempt body hold a reference, the buffer is returned to the pool once all were released.
+type bodyBuffer struct {
+	buf  *bytes.Buffer
+	refs int32
+}
+
+// newBodyBuffer reads the body into a pooled buffer, which is referenced once by the caller.
+func newBodyBuffer(body io.Reader, contentLength int64) (*bodyBuffer, error) {
+	buf := bodyBufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	if contentLength > 0 && contentLength <= maxPooledBodyBuffer {
+		buf.Grow(int(contentLength))
+	}
+
+	if _, err := buf.ReadFrom(body); err != nil {
+		putBodyBuffer(buf)
+		return nil, err
+	}
+	return &bodyBuffer{buf: buf, refs: 1}, nil
+}
+
+// getBody returns a reader of the buffered body, which has to be closed to release the buffer.
+func (b *bodyBuffer) getBody() (io.ReadCloser, error) {
+	for {
+		refs := atomic.LoadInt32(&b.refs)
+		if refs <= 0 {
+			return nil, errBodyBufferReleased
+		}
+		if atomic.CompareAndSwapInt32(&b.refs, refs, refs+1) {
+			break
+		}
+	}
+
+	body := &bodyBufferReader{buffer: b}
+	body.reader.Reset(b.buf.Bytes())
+	return body, nil
+}
+
+// release drops a reference and returns the buffer to the pool if it was the last one.
+func (b *bodyBuffer) release() {
+	if atomic.AddInt32(&b.refs, -1) == 0 {
+		putBodyBuffer(b.buf)
+	}
+}
+
+func putBodyBuffer(buf *bytes.Buffer) {
+	if buf.Cap() <= maxPooledBodyBuffer {
+		bodyBufferPool.Put(buf)
+	}
+}
+
+// bodyBufferReader reads the body of a single attempt from the shared buffer.
+//
+// Read and Close are synchronized, since the transport may close the body while it is still written,
+// and the buffer must not be read anymore once it went back to the pool.
+type bodyBufferReader struct {
+	mu     sync.Mutex
+	reader bytes.Reader
+	buffer *bodyBuffer
+}
+
+func (r *bodyBufferReader) Read(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.buffer == nil {
+		return 0, io.ErrClosedPipe
+	}
+	return r.reader.Read(p)
+}
+
+func (r *bodyBufferReader) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.buffer != nil {
+		r.buffer.release()
+		r.buffer = nil
+		r.reader.Reset(nil)
+	}
+	return nil
+}
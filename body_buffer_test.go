@@ -0,0 +1,40 @@
+package httpretry
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestBodyBuffer(t *testing.T) {
+	check := assert.New(t)
+
+	t.Run("should return independent readers until released", func(t *testing.T) {
+		buffer, err := newBodyBuffer(strings.NewReader("body"), 4)
+		check.NoError(err)
+
+		first, err := buffer.getBody()
+		check.NoError(err)
+		second, err := buffer.getBody()
+		check.NoError(err)
+
+		data, _ := io.ReadAll(first)
+		check.Equal("body", string(data))
+		data, _ = io.ReadAll(second)
+		check.Equal("body", string(data))
+
+		buffer.release()
+		check.NoError(first.Close())
+		check.NoError(first.Close(), "closing twice must not release twice")
+		check.Equal(int32(1), buffer.refs)
+
+		check.NoError(second.Close())
+		check.Equal(int32(0), buffer.refs)
+
+		_, err = buffer.getBody()
+		check.Equal(errBodyBufferReleased, err)
+		_, err = first.Read(make([]byte, 1))
+		check.Equal(io.ErrClosedPipe, err)
+	})
+}
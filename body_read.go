@@ -0,0 +1,180 @@
+package httpretry
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+const (
+	// defaultBodyBufferLimit is the maximum number of bytes that are buffered by BodyReadBuffered, if no limit is set
+	defaultBodyBufferLimit = 1 << 20
+)
+
+// ErrResourceChanged is returned if a body could not be resumed, because the resource changed in the meantime.
+var ErrResourceChanged = errors.New("resource changed while resuming the body")
+
+// BodyReadMode defines how failures while reading the response body are handled.
+type BodyReadMode int
+
+const (
+	// BodyReadDirect returns the response body as it is, read failures are returned to the caller (default).
+	BodyReadDirect BodyReadMode = iota
+	// BodyReadBuffered reads the response body (up to BodyBufferLimit bytes) before returning the response,
+	// so read failures are handled by the retry policy like other errors.
+	BodyReadBuffered
+	// BodyReadResumable returns a body that re-issues GET requests if reading fails, up to MaxRetryCount times.
+	// If the server supports byte ranges (ETag and Accept-Ranges), only the remaining bytes are requested.
+	// The body is only resumed if the resource has a strong ETag or Last-Modified and Content-Length.
+	BodyReadResumable
+)
+
+var bodyReadModeNames = map[BodyReadMode]string{
+	BodyReadDirect:    "direct",
+	BodyReadBuffered:  "buffered",
+	BodyReadResumable: "resumable",
+}
+
+// String returns the name of the body read mode.
+func (m BodyReadMode) String() string {
+	if name, ok := bodyReadModeNames[m]; ok {
+		return name
+	}
+	return fmt.Sprintf("BodyReadMode(%d)", int(m))
+}
+
+// bufferBody reads the first limit bytes of the response body, so read failures occur within the retry loop.
+//
+// Bodies that are larger than the limit are streamed after the buffered bytes.
+// The body is closed if reading failed.
+func bufferBody(resp *http.Response, limit int64) error {
+	if resp == nil || resp.Body == nil || resp.Body == http.NoBody {
+		return nil
+	}
+	if limit <= 0 {
+		limit = defaultBodyBufferLimit
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, limit))
+	if err != nil {
+		resp.Body.Close()
+		return err
+	}
+
+	if int64(len(data)) < limit {
+		resp.Body.Close()
+		resp.Body = io.NopCloser(bytes.NewReader(data))
+		return nil
+	}
+	resp.Body = newPeekedBody(data, resp.Body, nil)
+	return nil
+}
+
+// resumableBody re-issues the request if reading the body fails and continues with the remaining bytes.
+type resumableBody struct {
+	retryRoundtripper *RetryRoundtripper
+	req               *http.Request
+	body              io.ReadCloser
+	version           resourceVersion
+	etag              string
+	ranges            bool
+	offset            int64
+	resumes           int
+}
+
+// newResumableBody wraps the body of the response, if it can be resumed.
+func newResumableBody(r *RetryRoundtripper, req *http.Request, resp *http.Response) io.ReadCloser {
+	if req.Method != http.MethodGet || resp.StatusCode != http.StatusOK || resp.Body == nil || resp.Body == http.NoBody {
+		return resp.Body
+	}
+
+	// resumed requests are sent with their own retries, but must not be resumed themselves
+	config := r.clone()
+	config.BodyReadMode = BodyReadDirect
+
+	// without a validator, a changed resource could not be detected and the body would mix both versions
+	version, ok := newResourceVersion(resp)
+	if !ok {
+		return resp.Body
+	}
+
+	etag, ranges := rangeValidator(resp)
+	return &resumableBody{
+		retryRoundtripper: config,
+		req:               req,
+		body:              resp.Body,
+		version:           version,
+		etag:              etag,
+		ranges:            ranges,
+	}
+}
+
+func (b *resumableBody) Read(p []byte) (int, error) {
+	for {
+		n, err := b.body.Read(p)
+		b.offset += int64(n)
+		if err == nil || err == io.EOF {
+			return n, err
+		}
+		if n > 0 {
+			// the error will be returned again by the next read
+			return n, nil
+		}
+		if b.resumes >= b.retryRoundtripper.MaxRetryCount || b.req.Context().Err() != nil {
+			return 0, err
+		}
+
+		b.resumes++
+		if err := b.resume(); err != nil {
+			return 0, err
+		}
+	}
+}
+
+func (b *resumableBody) Close() error {
+	return b.body.Close()
+}
+
+// resume re-issues the request and continues the body at the current offset.
+func (b *resumableBody) resume() error {
+	b.body.Close()
+
+	req := b.req.Clone(b.req.Context())
+	if b.ranges {
+		setRange(req, b.offset, b.etag)
+	}
+	resp, err := b.retryRoundtripper.roundTrip(req)
+	if err != nil {
+		return err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		r, err := parseContentRange(resp.Header.Get("Content-Range"))
+		if err == nil && r.start != b.offset {
+			err = fmt.Errorf("resumed body starts at %d instead of %d", r.start, b.offset)
+		}
+		if err != nil {
+			b.retryRoundtripper.drainBody(resp)
+			return err
+		}
+	case http.StatusOK:
+		// the range was ignored (or not requested), so the delivered bytes are skipped, if the resource did not change
+		if !b.version.matches(resp) {
+			b.retryRoundtripper.drainBody(resp)
+			return ErrResourceChanged
+		}
+		if _, err := io.CopyN(io.Discard, resp.Body, b.offset); err != nil {
+			resp.Body.Close()
+			return err
+		}
+	default:
+		b.retryRoundtripper.drainBody(resp)
+		return fmt.Errorf("unexpected status code %d while resuming the body", resp.StatusCode)
+	}
+
+	b.body = resp.Body
+	return nil
+}
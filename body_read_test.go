@@ -0,0 +1,251 @@
+package httpretry
+
+import (
+	"bytes"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// failingBody returns the data and fails afterwards.
+type failingBody struct {
+	data io.Reader
+	err  error
+}
+
+func (b *failingBody) Read(p []byte) (int, error) {
+	n, err := b.data.Read(p)
+	if err == io.EOF {
+		return n, b.err
+	}
+	return n, err
+}
+
+func (b *failingBody) Close() error {
+	return nil
+}
+
+func TestRetryRoundtripperBufferedBody(t *testing.T) {
+	check := assert.New(t)
+
+	mockRoundtripper := &MockRoundtripper{}
+
+	retryRoundtripper := RetryRoundtripper{
+		MaxRetryCount:    3,
+		Next:             mockRoundtripper,
+		ShouldRetry:      DefaultRetryPolicy,
+		CalculateBackoff: (&MockBackoffPolicy{}).CalculateBackoff,
+	}
+	WithBufferedBody(8)(&retryRoundtripper)
+
+	t.Run("should retry on body read failure", func(t *testing.T) {
+		mockRoundtripper.reset()
+		mockRoundtripper.RoundTripFunc = func(req *http.Request, called int) (response *http.Response, e error) {
+			resp := FakeResponse(req, 200, []byte("ok"))
+			if called == 1 {
+				resp.Body = &failingBody{data: strings.NewReader("o"), err: syscall.ECONNRESET}
+			}
+			return resp, nil
+		}
+
+		req, _ := http.NewRequest("GET", "https://my-super-nonexisting-url.asd", nil)
+		res, err := retryRoundtripper.RoundTrip(req)
+
+		check.NoError(err)
+		check.Equal(2, mockRoundtripper.CallCount)
+		check.True(readerContains(t, res.Body, "ok"))
+	})
+
+	t.Run("should stream bodies larger than the limit", func(t *testing.T) {
+		mockRoundtripper.reset()
+		mockRoundtripper.RoundTripFunc = func(req *http.Request, called int) (response *http.Response, e error) {
+			return FakeResponse(req, 200, []byte("0123456789abcdef")), nil
+		}
+
+		req, _ := http.NewRequest("GET", "https://my-super-nonexisting-url.asd", nil)
+		res, err := retryRoundtripper.RoundTrip(req)
+
+		check.NoError(err)
+		data, _ := io.ReadAll(res.Body)
+		check.Equal("0123456789abcdef", string(data))
+	})
+
+	t.Run("should return read error if not retried", func(t *testing.T) {
+		mockRoundtripper.reset()
+		mockRoundtripper.RoundTripFunc = func(req *http.Request, called int) (response *http.Response, e error) {
+			resp := FakeResponse(req, 200, nil)
+			resp.Body = &failingBody{data: strings.NewReader("o"), err: syscall.ECONNRESET}
+			return resp, nil
+		}
+
+		req, _ := http.NewRequest("GET", "https://my-super-nonexisting-url.asd", nil)
+		res, err := retryRoundtripper.RoundTrip(req)
+
+		check.Nil(res)
+		check.True(errors.Is(err, syscall.ECONNRESET))
+		check.Equal(4, mockRoundtripper.CallCount)
+	})
+}
+
+func TestRetryRoundtripperResumableBody(t *testing.T) {
+	check := assert.New(t)
+
+	const content = "0123456789abcdef"
+
+	mockRoundtripper := &MockRoundtripper{}
+
+	retryRoundtripper := RetryRoundtripper{
+		MaxRetryCount:    3,
+		Next:             mockRoundtripper,
+		ShouldRetry:      DefaultRetryPolicy,
+		CalculateBackoff: (&MockBackoffPolicy{}).CalculateBackoff,
+	}
+	WithResumableBody()(&retryRoundtripper)
+
+	// serve returns the content from the requested offset, the first response fails after 5 bytes
+	serve := func(etag string, ranges bool, rangeHeaders *[]string) func(req *http.Request, called int) (*http.Response, error) {
+		return func(req *http.Request, called int) (*http.Response, error) {
+			*rangeHeaders = append(*rangeHeaders, req.Header.Get("Range")+" "+req.Header.Get("If-Range"))
+
+			resp := FakeResponse(req, 200, nil)
+			resp.Uncompressed = false
+			resp.Header = http.Header{"Etag": {etag}}
+			if ranges {
+				resp.Header.Set("Accept-Ranges", "bytes")
+			}
+
+			body := content
+			if rangeHeader := req.Header.Get("Range"); rangeHeader != "" && req.Header.Get("If-Range") == etag {
+				offset, _ := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(rangeHeader, "bytes="), "-"))
+				resp.StatusCode = http.StatusPartialContent
+				resp.Header.Set("Content-Range", "bytes "+strconv.Itoa(offset)+"-"+strconv.Itoa(len(content)-1)+"/"+strconv.Itoa(len(content)))
+				body = content[offset:]
+			}
+
+			if called == 1 {
+				resp.Body = &failingBody{data: strings.NewReader(body[:5]), err: io.ErrUnexpectedEOF}
+			} else {
+				resp.Body = io.NopCloser(strings.NewReader(body))
+			}
+			return resp, nil
+		}
+	}
+
+	t.Run("should resume with range request", func(t *testing.T) {
+		mockRoundtripper.reset()
+		var rangeHeaders []string
+		mockRoundtripper.RoundTripFunc = serve(`"v1"`, true, &rangeHeaders)
+
+		req, _ := http.NewRequest("GET", "https://my-super-nonexisting-url.asd", nil)
+		res, err := retryRoundtripper.RoundTrip(req)
+		check.NoError(err)
+
+		data, err := io.ReadAll(res.Body)
+		check.NoError(err)
+		check.Equal(content, string(data))
+		check.Equal([]string{" ", `bytes=5- "v1"`}, rangeHeaders)
+	})
+
+	t.Run("should resume without range support", func(t *testing.T) {
+		mockRoundtripper.reset()
+		var rangeHeaders []string
+		mockRoundtripper.RoundTripFunc = serve(`"v1"`, false, &rangeHeaders)
+
+		req, _ := http.NewRequest("GET", "https://my-super-nonexisting-url.asd", nil)
+		res, err := retryRoundtripper.RoundTrip(req)
+		check.NoError(err)
+
+		data, err := io.ReadAll(res.Body)
+		check.NoError(err)
+		check.Equal(content, string(data))
+		check.Equal([]string{" ", " "}, rangeHeaders)
+	})
+
+	t.Run("should fail if resource changed", func(t *testing.T) {
+		mockRoundtripper.reset()
+		var rangeHeaders []string
+		mockRoundtripper.RoundTripFunc = func(req *http.Request, called int) (*http.Response, error) {
+			return serve(`"v`+strconv.Itoa(called)+`"`, true, &rangeHeaders)(req, called)
+		}
+
+		req, _ := http.NewRequest("GET", "https://my-super-nonexisting-url.asd", nil)
+		res, err := retryRoundtripper.RoundTrip(req)
+		check.NoError(err)
+
+		var buf bytes.Buffer
+		_, err = io.Copy(&buf, res.Body)
+		check.True(errors.Is(err, ErrResourceChanged))
+		check.Equal(content[:5], buf.String())
+	})
+
+	t.Run("should give up after max retry count", func(t *testing.T) {
+		mockRoundtripper.reset()
+		mockRoundtripper.RoundTripFunc = func(req *http.Request, called int) (*http.Response, error) {
+			resp := FakeResponse(req, 200, nil)
+			resp.Header = http.Header{"Etag": {`"v1"`}}
+			resp.Body = &failingBody{data: strings.NewReader(""), err: io.ErrUnexpectedEOF}
+			return resp, nil
+		}
+
+		req, _ := http.NewRequest("GET", "https://my-super-nonexisting-url.asd", nil)
+		res, err := retryRoundtripper.RoundTrip(req)
+		check.NoError(err)
+
+		_, err = io.ReadAll(res.Body)
+		check.Equal(io.ErrUnexpectedEOF, err)
+		check.Equal(4, mockRoundtripper.CallCount)
+	})
+
+	t.Run("should not resume without validator", func(t *testing.T) {
+		mockRoundtripper.reset()
+		var rangeHeaders []string
+		mockRoundtripper.RoundTripFunc = serve(`W/"v1"`, false, &rangeHeaders)
+
+		req, _ := http.NewRequest("GET", "https://my-super-nonexisting-url.asd", nil)
+		res, err := retryRoundtripper.RoundTrip(req)
+		check.NoError(err)
+
+		data, err := io.ReadAll(res.Body)
+		check.Equal(io.ErrUnexpectedEOF, err)
+		check.Equal(content[:5], string(data))
+		check.Equal(1, mockRoundtripper.CallCount)
+	})
+
+	t.Run("should resume with last modified and content length", func(t *testing.T) {
+		for _, changed := range []bool{false, true} {
+			mockRoundtripper.reset()
+			mockRoundtripper.RoundTripFunc = func(req *http.Request, called int) (*http.Response, error) {
+				resp := FakeResponse(req, 200, nil)
+				resp.Header = http.Header{"Last-Modified": {"Mon, 02 Jan 2006 15:04:05 GMT"}}
+				resp.ContentLength = int64(len(content))
+				if called == 1 {
+					resp.Body = &failingBody{data: strings.NewReader(content[:5]), err: io.ErrUnexpectedEOF}
+					return resp, nil
+				}
+				if changed {
+					resp.Header.Set("Last-Modified", "Tue, 03 Jan 2006 15:04:05 GMT")
+				}
+				resp.Body = io.NopCloser(strings.NewReader(content))
+				return resp, nil
+			}
+
+			req, _ := http.NewRequest("GET", "https://my-super-nonexisting-url.asd", nil)
+			res, err := retryRoundtripper.RoundTrip(req)
+			check.NoError(err)
+
+			data, err := io.ReadAll(res.Body)
+			if changed {
+				check.True(errors.Is(err, ErrResourceChanged))
+				check.Equal(content[:5], string(data))
+			} else {
+				check.NoError(err)
+				check.Equal(content, string(data))
+			}
+		}
+	})
+}
@@ -0,0 +1,139 @@
+package httpretry
+
+import (
+	"errors"
+	"net/http"
+)
+
+const (
+	// maxChainDepth protects against cycles in roundtripper chains
+	maxChainDepth = 100
+)
+
+// Unwrapper is implemented by roundtrippers that wrap another roundtripper (like the RetryRoundtripper does).
+//
+// Implement it in your own middlewares, so the helpers of this package are able to find the retry roundtripper
+// and the http.Transport anywhere in the chain.
+type Unwrapper interface {
+	Unwrap() http.RoundTripper
+}
+
+// Middleware wraps a roundtripper with additional functionality.
+type Middleware func(next http.RoundTripper) http.RoundTripper
+
+// Unwrap returns the next roundtripper in the chain.
+func (r *RetryRoundtripper) Unwrap() http.RoundTripper {
+	return r.snapshot().Next
+}
+
+// FindRetryRoundtripper returns the first retry roundtripper in the chain or nil if there is none.
+func FindRetryRoundtripper(roundtripper http.RoundTripper) *RetryRoundtripper {
+	var retryRoundtripper *RetryRoundtripper
+	walkChain(roundtripper, func(rt http.RoundTripper) bool {
+		retryRoundtripper, _ = rt.(*RetryRoundtripper)
+		return retryRoundtripper != nil
+	})
+	return retryRoundtripper
+}
+
+// FindTransport returns the first http.Transport in the chain or nil if there is none.
+func FindTransport(roundtripper http.RoundTripper) *http.Transport {
+	var transport *http.Transport
+	walkChain(roundtripper, func(rt http.RoundTripper) bool {
+		transport, _ = rt.(*http.Transport)
+		return transport != nil
+	})
+	return transport
+}
+
+// UseInside inserts the middlewares between the retry roundtripper and the original roundtripper,
+// so they are executed for every attempt. The first middleware is the outermost.
+//
+// It returns an error if the client does not contain a retry roundtripper.
+func UseInside(client *http.Client, middlewares ...Middleware) error {
+	if client == nil {
+		panic("client must not be nil")
+	}
+
+	retryRoundtripper := FindRetryRoundtripper(client.Transport)
+	if retryRoundtripper == nil {
+		return errors.New("client does not contain a retry roundtripper")
+	}
+
+	retryRoundtripper.Update(WithAttemptMiddleware(middlewares...))
+	return nil
+}
+
+// UseOutside wraps the middlewares around the client's roundtripper (including the retry roundtripper),
+// so they are executed once per call. The first middleware is the outermost.
+func UseOutside(client *http.Client, middlewares ...Middleware) {
+	if client == nil {
+		panic("client must not be nil")
+	}
+
+	next := client.Transport
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	client.Transport = chain(next, middlewares)
+}
+
+// chain wraps the middlewares around next, the first middleware is the outermost.
+//
+// Every link of the chain implements Unwrapper, even if the middleware itself does not.
+func chain(next http.RoundTripper, middlewares []Middleware) http.RoundTripper {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		next = &middlewareRoundtripper{
+			RoundTripper: middlewares[i](next),
+			next:         next,
+			middleware:   middlewares[i],
+		}
+	}
+	return next
+}
+
+// unchain returns the roundtripper the links of chain() wrapped and their middlewares, the first is the outermost.
+func unchain(roundtripper http.RoundTripper) (http.RoundTripper, []Middleware) {
+	var middlewares []Middleware
+	for i := 0; i < maxChainDepth; i++ {
+		m, ok := roundtripper.(*middlewareRoundtripper)
+		if !ok {
+			break
+		}
+		middlewares = append(middlewares, m.middleware)
+		roundtripper = m.next
+	}
+	return roundtripper, middlewares
+}
+
+// middlewareRoundtripper remembers the roundtripper a middleware wrapped.
+type middlewareRoundtripper struct {
+	http.RoundTripper
+	next       http.RoundTripper
+	middleware Middleware
+}
+
+// Unwrap returns the roundtripper the middleware wrapped.
+func (m *middlewareRoundtripper) Unwrap() http.RoundTripper {
+	return m.next
+}
+
+// walkChain calls f for every roundtripper in the chain, until f returns true.
+func walkChain(roundtripper http.RoundTripper, f func(rt http.RoundTripper) bool) {
+	for i := 0; roundtripper != nil && i < maxChainDepth; i++ {
+		if f(roundtripper) {
+			return
+		}
+		if m, ok := roundtripper.(*middlewareRoundtripper); ok {
+			// the middleware itself may be the roundtripper we are looking for
+			if f(m.RoundTripper) {
+				return
+			}
+		}
+		unwrapper, ok := roundtripper.(Unwrapper)
+		if !ok {
+			return
+		}
+		roundtripper = unwrapper.Unwrap()
+	}
+}
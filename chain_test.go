@@ -0,0 +1,143 @@
+package httpretry_test
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/ybbus/httpretry"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// wrappingRoundtripper is a middleware of another library that implements the Unwrap protocol
+type wrappingRoundtripper struct {
+	next http.RoundTripper
+}
+
+func (w *wrappingRoundtripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	return w.next.RoundTrip(req)
+}
+
+func (w *wrappingRoundtripper) Unwrap() http.RoundTripper {
+	return w.next
+}
+
+// countingMiddleware counts the requests that pass
+func countingMiddleware(counter *int32) httpretry.Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			atomic.AddInt32(counter, 1)
+			return next.RoundTrip(req)
+		})
+	}
+}
+
+type roundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestFindInChain(t *testing.T) {
+	check := assert.New(t)
+
+	transport := &http.Transport{}
+	client := httpretry.NewCustomClient(&http.Client{Transport: &wrappingRoundtripper{next: transport}})
+	client.Transport = &wrappingRoundtripper{next: client.Transport}
+	retryRoundtripper := client.Transport.(*wrappingRoundtripper).next.(*httpretry.RetryRoundtripper)
+
+	t.Run("should find retry roundtripper in chain", func(t *testing.T) {
+		check.Same(retryRoundtripper, httpretry.FindRetryRoundtripper(client.Transport))
+		check.Nil(httpretry.FindRetryRoundtripper(transport))
+		check.Nil(httpretry.FindRetryRoundtripper(nil))
+	})
+
+	t.Run("should find transport in chain", func(t *testing.T) {
+		check.Same(transport, httpretry.FindTransport(client.Transport))
+		check.Nil(httpretry.FindTransport(&CustomRoundtripper{}))
+	})
+
+	t.Run("helpers should work with wrapped retry roundtripper", func(t *testing.T) {
+		original, err := httpretry.GetOriginalTransport(client)
+		check.NoError(err)
+		check.Same(transport, original)
+
+		check.NoError(httpretry.ModifyOriginalTransport(client, func(t *http.Transport) { t.TLSHandshakeTimeout = 42 * time.Second }))
+		check.Equal(42*time.Second, transport.TLSHandshakeTimeout)
+
+		newTransport := &http.Transport{}
+		check.NoError(httpretry.ReplaceOriginalRoundtripper(client, newTransport))
+		check.Same(newTransport, httpretry.GetOriginalRoundtripper(client))
+		check.IsType(&wrappingRoundtripper{}, client.Transport)
+	})
+}
+
+func TestMiddlewares(t *testing.T) {
+	check := assert.New(t)
+
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1)%3 != 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	t.Run("should execute inside middlewares per attempt and outside middlewares per call", func(t *testing.T) {
+		var inside, outside, option int32
+		client := httpretry.NewDefaultClient(
+			httpretry.WithBackoffPolicy(httpretry.ConstantBackoff(0, 0)),
+			httpretry.WithAttemptMiddleware(countingMiddleware(&option)),
+		)
+		check.NoError(httpretry.UseInside(client, countingMiddleware(&inside)))
+		httpretry.UseOutside(client, countingMiddleware(&outside))
+
+		res, err := client.Get(server.URL)
+		check.NoError(err)
+		check.Equal(http.StatusOK, res.StatusCode)
+
+		check.Equal(int32(3), atomic.LoadInt32(&inside))
+		check.Equal(int32(3), atomic.LoadInt32(&option))
+		check.Equal(int32(1), atomic.LoadInt32(&outside))
+
+		// the chain is still walkable
+		check.NotNil(httpretry.FindRetryRoundtripper(client.Transport))
+		transport, err := httpretry.GetOriginalTransport(client)
+		check.NoError(err)
+		check.Same(http.DefaultTransport, transport)
+	})
+
+	t.Run("should keep inside middlewares when replacing the original roundtripper", func(t *testing.T) {
+		var inside, option int32
+		client := httpretry.NewDefaultClient(
+			httpretry.WithBackoffPolicy(httpretry.ConstantBackoff(0, 0)),
+			httpretry.WithAttemptMiddleware(countingMiddleware(&option)),
+		)
+		check.NoError(httpretry.UseInside(client, countingMiddleware(&inside)))
+		check.Same(http.DefaultTransport, httpretry.GetOriginalRoundtripper(client))
+
+		var replaced int32
+		replacement := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			atomic.AddInt32(&replaced, 1)
+			return http.DefaultTransport.RoundTrip(req)
+		})
+		check.NoError(httpretry.ReplaceOriginalRoundtripper(client, replacement))
+		check.IsType(replacement, httpretry.GetOriginalRoundtripper(client))
+
+		atomic.StoreInt32(&calls, 0)
+		res, err := client.Get(server.URL)
+		check.NoError(err)
+		check.Equal(http.StatusOK, res.StatusCode)
+
+		check.Equal(int32(3), atomic.LoadInt32(&inside))
+		check.Equal(int32(3), atomic.LoadInt32(&option))
+		check.Equal(int32(3), atomic.LoadInt32(&replaced))
+	})
+
+	t.Run("UseInside should return error without retry roundtripper", func(t *testing.T) {
+		check.Error(httpretry.UseInside(&http.Client{}, countingMiddleware(new(int32))))
+	})
+}
@@ -2,6 +2,7 @@ package httpretry
 
 import (
 	"errors"
+	"fmt"
 	"net/http"
 )
 
@@ -40,7 +41,50 @@ func NewCustomClient(client *http.Client, opts ...Option) *http.Client {
 		panic("client must not be nil")
 	}
 
-	nextRoundtripper := client.Transport
+	retryRoundtripper := newRetryRoundtripper(client.Transport, opts...)
+	disableClientRedirects(client, retryRoundtripper)
+	client.Transport = retryRoundtripper
+
+	return client
+}
+
+// NewValidatedDefaultClient works like NewDefaultClient, but returns an error if the resulting configuration is invalid
+// (e.g. a nil retry or backoff policy).
+func NewValidatedDefaultClient(opts ...Option) (*http.Client, error) {
+	return NewValidatedCustomClient(&http.Client{}, opts...)
+}
+
+// NewValidatedCustomClient works like NewCustomClient, but returns an error if the client is nil or the resulting
+// configuration is invalid (e.g. a nil Next roundtripper or a nil retry or backoff policy).
+//
+// The provided client is not modified if an error is returned.
+func NewValidatedCustomClient(client *http.Client, opts ...Option) (*http.Client, error) {
+	if client == nil {
+		return nil, errors.New("client must not be nil")
+	}
+
+	retryRoundtripper := newRetryRoundtripper(client.Transport, opts...)
+	if err := retryRoundtripper.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid retry configuration: %w", err)
+	}
+
+	disableClientRedirects(client, retryRoundtripper)
+	client.Transport = retryRoundtripper
+
+	return client, nil
+}
+
+// disableClientRedirects stops the client from following redirects if the retry roundtripper follows them.
+//
+// A CheckRedirect set by the user is kept.
+func disableClientRedirects(client *http.Client, retryRoundtripper *RetryRoundtripper) {
+	if retryRoundtripper.FollowRedirects && client.CheckRedirect == nil {
+		client.CheckRedirect = stopRedirects
+	}
+}
+
+// newRetryRoundtripper returns a retry roundtripper with the defaults and the provided options applied.
+func newRetryRoundtripper(nextRoundtripper http.RoundTripper, opts ...Option) *RetryRoundtripper {
 	if nextRoundtripper == nil {
 		nextRoundtripper = http.DefaultTransport
 	}
@@ -49,98 +93,121 @@ func NewCustomClient(client *http.Client, opts ...Option) *http.Client {
 	retryRoundtripper := &RetryRoundtripper{
 		Next:             nextRoundtripper,
 		MaxRetryCount:    defaultMaxRetryCount,
-		ShouldRetry:      defaultRetryPolicy,
+		ShouldRetry:      DefaultRetryPolicy,
 		CalculateBackoff: defaultBackoffPolicy,
 	}
+	retryRoundtripper.setLabels(defaultPolicyLabels)
 
 	// overwrite defaults with user provided configuration
 	for _, o := range opts {
 		o(retryRoundtripper)
 	}
 
-	client.Transport = retryRoundtripper
+	return retryRoundtripper
+}
 
-	return client
+// retryConfig returns a snapshot of the configuration of the client's retry roundtripper,
+// or the default configuration if the client has no retry roundtripper.
+func retryConfig(client *http.Client) *RetryRoundtripper {
+	if r := FindRetryRoundtripper(client.Transport); r != nil {
+		return r.snapshot()
+	}
+	return newRetryRoundtripper(client.Transport)
 }
 
 // GetOriginalRoundtripper returns the original roundtripper that was embedded in the retry roundtripper.
+//
+// The retry roundtripper is searched in the whole roundtripper chain (see Unwrapper).
+// Middlewares inserted with UseInside or WithAttemptMiddleware are skipped.
 func GetOriginalRoundtripper(client *http.Client) http.RoundTripper {
 	if client == nil {
 		panic("client must not be nil")
 	}
 
-	switch r := client.Transport.(type) {
-	case *RetryRoundtripper:
-		return r.Next
-	default: // also catches Transport == nil
-		return client.Transport
+	if r := FindRetryRoundtripper(client.Transport); r != nil {
+		original, _ := unchain(r.Unwrap())
+		return original
 	}
+	// also catches Transport == nil
+	return client.Transport
 }
 
 // ReplaceOriginalRoundtripper replaces the original roundtripper that was embedded in the retry roundtripper
+//
+// The retry roundtripper is searched in the whole roundtripper chain (see Unwrapper).
+// Middlewares inserted with UseInside or WithAttemptMiddleware are kept, they are applied again to the new roundtripper.
 func ReplaceOriginalRoundtripper(client *http.Client, roundtripper http.RoundTripper) error {
 	if client == nil {
 		panic("client must not be nil")
 	}
 
-	switch r := client.Transport.(type) {
-	case *RetryRoundtripper:
-		r.Next = roundtripper
-		return nil
-	default:
-		client.Transport = roundtripper
+	if r := FindRetryRoundtripper(client.Transport); r != nil {
+		r.Update(func(r *RetryRoundtripper) {
+			_, middlewares := unchain(r.Next)
+			r.Next = chain(roundtripper, middlewares)
+		})
 		return nil
 	}
+	client.Transport = roundtripper
+	return nil
 }
 
 // GetOriginalTransport retrieves the original http.Transport that was mebedded in the retry roundtripper.
+//
+// The retry roundtripper and the http.Transport are searched in the whole roundtripper chain (see Unwrapper).
 func GetOriginalTransport(client *http.Client) (*http.Transport, error) {
 	if client == nil {
 		panic("client must not be nil")
 	}
 
-	switch r := client.Transport.(type) {
-	case *RetryRoundtripper:
-		switch t := r.Next.(type) {
-		case *http.Transport:
-			return t, nil
-		case nil:
+	if r := FindRetryRoundtripper(client.Transport); r != nil {
+		next := r.Unwrap()
+		if next == nil {
 			return nil, nil
-		default:
-			return nil, errors.New("embedded roundtripper is not of type *http.Transport")
 		}
-	case *http.Transport:
-		return r, nil
-	case nil:
+		if t := FindTransport(next); t != nil {
+			return t, nil
+		}
+		return nil, errors.New("embedded roundtripper is not of type *http.Transport")
+	}
+
+	if client.Transport == nil {
 		return nil, nil
-	default:
-		return nil, errors.New("roundtripper is not of type *http.Transport")
 	}
+	if t := FindTransport(client.Transport); t != nil {
+		return t, nil
+	}
+	return nil, errors.New("roundtripper is not of type *http.Transport")
 }
 
 // ModifyOriginalTransport allows to modify the original http.Transport that was embedded in the retry roundtipper.
+//
+// The retry roundtripper and the http.Transport are searched in the whole roundtripper chain (see Unwrapper).
 func ModifyOriginalTransport(client *http.Client, f func(transport *http.Transport)) error {
 	if client == nil {
 		panic("client must not be nil")
 	}
 
-	switch r := client.Transport.(type) {
-	case *http.Transport:
-		f(r)
-		return nil
-	case *RetryRoundtripper:
-		switch t := r.Next.(type) {
-		case nil:
+	if r := FindRetryRoundtripper(client.Transport); r != nil {
+		next := r.Unwrap()
+		if next == nil {
 			return errors.New("embedded transport was nil")
-		case *http.Transport:
-			f(t)
-			return nil
-		default:
+		}
+		t := FindTransport(next)
+		if t == nil {
 			return errors.New("embedded roundtripper is not of type *http.Transport")
 		}
-	case nil:
+		f(t)
+		return nil
+	}
+
+	if client.Transport == nil {
 		return errors.New("transport was nil")
-	default:
+	}
+	t := FindTransport(client.Transport)
+	if t == nil {
 		return errors.New("transport is not of type *http.Transport")
 	}
+	f(t)
+	return nil
 }
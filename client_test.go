@@ -78,6 +78,36 @@ func TestNewCustomClient(t *testing.T) {
 	})
 }
 
+func TestNewValidatedCustomClient(t *testing.T) {
+	check := assert.New(t)
+
+	t.Run("should create valid client", func(t *testing.T) {
+		client, err := httpretry.NewValidatedDefaultClient(httpretry.WithMaxRetryCount(2))
+		check.NoError(err)
+		check.IsType(&httpretry.RetryRoundtripper{}, client.Transport)
+		check.Equal(2, client.Transport.(*httpretry.RetryRoundtripper).MaxRetryCount)
+	})
+
+	t.Run("should return error on nil client", func(t *testing.T) {
+		client, err := httpretry.NewValidatedCustomClient(nil)
+		check.Nil(client)
+		check.EqualError(err, "client must not be nil")
+	})
+
+	t.Run("should return error on invalid configuration and keep client untouched", func(t *testing.T) {
+		customTransport := &http.Transport{}
+		httpClient := &http.Client{Transport: customTransport}
+
+		client, err := httpretry.NewValidatedCustomClient(httpClient, httpretry.WithBackoffPolicy(nil))
+		check.Nil(client)
+		check.ErrorContains(err, "backoff policy must not be nil")
+		check.Equal(customTransport, httpClient.Transport)
+
+		_, err = httpretry.NewValidatedDefaultClient(httpretry.WithRetryPolicy(nil))
+		check.ErrorContains(err, "retry policy must not be nil")
+	})
+}
+
 func TestGetOriginalRoundtripper(t *testing.T) {
 	check := assert.New(t)
 
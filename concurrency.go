@@ -0,0 +1,213 @@
+package httpretry
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// concurrencyDecreaseFactor is applied to the current limit when an overload was observed
+	concurrencyDecreaseFactor = 0.5
+	// hostIdleTimeout is the time after which the state of hosts without in-flight attempts is forgotten
+	hostIdleTimeout = time.Minute
+)
+
+// ConcurrencyLimitError is returned if a request was rejected, because the concurrency limit of the host
+// was reached and the queue was full.
+type ConcurrencyLimitError struct {
+	Host     string
+	Limit    int
+	InFlight int
+}
+
+func (e *ConcurrencyLimitError) Error() string {
+	return fmt.Sprintf("concurrency limit exceeded for host %s: %d of %d attempts in flight", e.Host, e.InFlight, e.Limit)
+}
+
+// ConcurrencyLimiter adaptively limits the number of in-flight attempts per host.
+//
+// The limit is adjusted with additive-increase/multiplicative-decrease (AIMD):
+// every successful attempt increases the limit by 1/limit, every overload halves it.
+// An attempt is considered an overload, if the RetryPolicy decided to retry it and it failed with
+// 429 Too Many Requests, 503 Service Unavailable or a timeout, or if its latency exceeded the latency threshold.
+//
+// An attempt is in flight until the next roundtripper returned the response headers.
+//
+// The state of hosts without in-flight attempts is forgotten after a minute, they start with minLimit again.
+//
+// A ConcurrencyLimiter is safe for concurrent use and may be shared between multiple clients.
+type ConcurrencyLimiter struct {
+	minLimit         float64
+	maxLimit         float64
+	maxQueue         int
+	latencyThreshold time.Duration
+
+	mu        sync.Mutex
+	hosts     map[string]*hostConcurrency
+	lastSweep time.Time
+}
+
+// hostConcurrency holds the state of a single host.
+type hostConcurrency struct {
+	limit    float64
+	inFlight int
+	waiters  []chan struct{}
+	lastUsed time.Time
+}
+
+// NewConcurrencyLimiter returns a concurrency limiter that starts with minLimit in-flight attempts per host and
+// adapts the limit between minLimit and maxLimit.
+//
+// maxQueue: the number of attempts per host that wait for a free slot, further attempts are rejected with a *ConcurrencyLimitError
+//
+// latencyThreshold: attempts that take longer are considered an overload. set to 0 to ignore latency
+func NewConcurrencyLimiter(minLimit int, maxLimit int, maxQueue int, latencyThreshold time.Duration) *ConcurrencyLimiter {
+	if minLimit < 1 {
+		minLimit = 1
+	}
+	if maxLimit < minLimit {
+		maxLimit = minLimit
+	}
+	if maxQueue < 0 {
+		maxQueue = 0
+	}
+	if latencyThreshold < 0 {
+		latencyThreshold = 0
+	}
+
+	return &ConcurrencyLimiter{
+		minLimit:         float64(minLimit),
+		maxLimit:         float64(maxLimit),
+		maxQueue:         maxQueue,
+		latencyThreshold: latencyThreshold,
+		hosts:            make(map[string]*hostConcurrency),
+		lastSweep:        time.Now(),
+	}
+}
+
+// Acquire waits for a free slot for the request's host.
+//
+// The returned release function must be called exactly once after the attempt finished.
+// overload reports whether the attempt failed because the host is overloaded.
+func (l *ConcurrencyLimiter) Acquire(req *http.Request) (release func(overload bool), err error) {
+	host := req.URL.Host
+
+	l.mu.Lock()
+	h := l.host(host)
+	if h.inFlight < h.currentLimit() {
+		h.inFlight++
+		l.mu.Unlock()
+		return l.releaseFunc(h, time.Now()), nil
+	}
+
+	if len(h.waiters) >= l.maxQueue {
+		err := &ConcurrencyLimitError{Host: host, Limit: h.currentLimit(), InFlight: h.inFlight}
+		l.mu.Unlock()
+		return nil, err
+	}
+
+	granted := make(chan struct{})
+	h.waiters = append(h.waiters, granted)
+	l.mu.Unlock()
+
+	select {
+	case <-granted:
+		return l.releaseFunc(h, time.Now()), nil
+	case <-req.Context().Done():
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		if !h.removeWaiter(granted) {
+			// the slot was granted concurrently, give it back
+			h.inFlight--
+			h.grant()
+		}
+		return nil, req.Context().Err()
+	}
+}
+
+// releaseFunc returns the function that releases the slot and adjusts the limit.
+func (l *ConcurrencyLimiter) releaseFunc(h *hostConcurrency, start time.Time) func(overload bool) {
+	var once sync.Once
+	return func(overload bool) {
+		once.Do(func() {
+			if l.latencyThreshold > 0 && time.Since(start) > l.latencyThreshold {
+				overload = true
+			}
+
+			l.mu.Lock()
+			defer l.mu.Unlock()
+
+			h.inFlight--
+			h.lastUsed = time.Now()
+			if overload {
+				h.limit = math.Max(h.limit*concurrencyDecreaseFactor, l.minLimit)
+			} else {
+				h.limit = math.Min(h.limit+1/h.limit, l.maxLimit)
+			}
+			h.grant()
+		})
+	}
+}
+
+// host returns the state of the given host, l.mu must be held.
+func (l *ConcurrencyLimiter) host(host string) *hostConcurrency {
+	now := time.Now()
+	if now.Sub(l.lastSweep) > hostIdleTimeout {
+		l.sweep(now)
+	}
+
+	h, ok := l.hosts[host]
+	if !ok {
+		h = &hostConcurrency{limit: l.minLimit}
+		l.hosts[host] = h
+	}
+	h.lastUsed = now
+	return h
+}
+
+// sweep forgets hosts without in-flight or waiting attempts that were idle for hostIdleTimeout, l.mu must be held.
+func (l *ConcurrencyLimiter) sweep(now time.Time) {
+	l.lastSweep = now
+	for host, h := range l.hosts {
+		if h.inFlight == 0 && len(h.waiters) == 0 && now.Sub(h.lastUsed) > hostIdleTimeout {
+			delete(l.hosts, host)
+		}
+	}
+}
+
+// currentLimit returns the number of attempts that may be in flight.
+func (h *hostConcurrency) currentLimit() int {
+	return int(h.limit)
+}
+
+// grant hands free slots to waiting attempts in FIFO order.
+func (h *hostConcurrency) grant() {
+	for len(h.waiters) > 0 && h.inFlight < h.currentLimit() {
+		h.inFlight++
+		close(h.waiters[0])
+		h.waiters = h.waiters[1:]
+	}
+}
+
+// removeWaiter removes the waiter from the queue and reports whether it was still waiting.
+func (h *hostConcurrency) removeWaiter(waiter chan struct{}) bool {
+	for i, w := range h.waiters {
+		if w == waiter {
+			h.waiters = append(h.waiters[:i], h.waiters[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// isOverload reports whether a failed attempt indicates that the host is overloaded.
+func isOverload(statusCode int, err error) bool {
+	switch statusCode {
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		return true
+	}
+	return ClassifyError(err) == ErrorClassTimeout
+}
@@ -0,0 +1,205 @@
+package httpretry
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestConcurrencyLimiter(t *testing.T) {
+	check := assert.New(t)
+
+	newRequest := func(ctx context.Context, url string) *http.Request {
+		req, _ := http.NewRequestWithContext(ctx, "GET", url, nil)
+		return req
+	}
+
+	t.Run("should reject if limit is reached and queue is full", func(t *testing.T) {
+		limiter := NewConcurrencyLimiter(1, 10, 0, 0)
+		req := newRequest(context.Background(), "https://host-a.asd")
+
+		release, err := limiter.Acquire(req)
+		check.NoError(err)
+
+		_, err = limiter.Acquire(req)
+		var limitErr *ConcurrencyLimitError
+		check.ErrorAs(err, &limitErr)
+		check.Equal("host-a.asd", limitErr.Host)
+		check.Equal(1, limitErr.Limit)
+		check.Equal(1, limitErr.InFlight)
+
+		// other hosts are not affected
+		_, err = limiter.Acquire(newRequest(context.Background(), "https://host-b.asd"))
+		check.NoError(err)
+
+		release(false)
+	})
+
+	t.Run("should queue until slot is released", func(t *testing.T) {
+		limiter := NewConcurrencyLimiter(1, 1, 1, 0)
+		req := newRequest(context.Background(), "https://host-a.asd")
+
+		release, err := limiter.Acquire(req)
+		check.NoError(err)
+
+		acquired := make(chan struct{})
+		go func() {
+			release, err := limiter.Acquire(req)
+			check.NoError(err)
+			close(acquired)
+			release(false)
+		}()
+
+		select {
+		case <-acquired:
+			t.Fatal("should not acquire before release")
+		case <-time.After(20 * time.Millisecond):
+		}
+
+		release(false)
+		select {
+		case <-acquired:
+		case <-time.After(1 * time.Second):
+			t.Fatal("should acquire after release")
+		}
+	})
+
+	t.Run("should return context error while queued", func(t *testing.T) {
+		limiter := NewConcurrencyLimiter(1, 1, 1, 0)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		release, err := limiter.Acquire(newRequest(context.Background(), "https://host-a.asd"))
+		check.NoError(err)
+
+		_, err = limiter.Acquire(newRequest(ctx, "https://host-a.asd"))
+		check.ErrorIs(err, context.DeadlineExceeded)
+		check.Empty(limiter.hosts["host-a.asd"].waiters)
+
+		release(false)
+		check.Equal(0, limiter.hosts["host-a.asd"].inFlight)
+	})
+
+	t.Run("should increase additively and decrease multiplicatively", func(t *testing.T) {
+		limiter := NewConcurrencyLimiter(1, 4, 0, 0)
+		req := newRequest(context.Background(), "https://host-a.asd")
+
+		for i := 0; i < 20; i++ {
+			release, err := limiter.Acquire(req)
+			check.NoError(err)
+			release(false)
+		}
+		check.Equal(4.0, limiter.hosts["host-a.asd"].limit)
+
+		release, _ := limiter.Acquire(req)
+		release(true)
+		check.Equal(2.0, limiter.hosts["host-a.asd"].limit)
+
+		release, _ = limiter.Acquire(req)
+		release(true)
+		release(true) // calling release twice has no effect
+		check.Equal(1.0, limiter.hosts["host-a.asd"].limit)
+	})
+
+	t.Run("should treat slow attempts as overload", func(t *testing.T) {
+		limiter := NewConcurrencyLimiter(1, 4, 0, 5*time.Millisecond)
+		limiter.host("host-a.asd").limit = 4
+		req := newRequest(context.Background(), "https://host-a.asd")
+
+		release, _ := limiter.Acquire(req)
+		time.Sleep(10 * time.Millisecond)
+		release(false)
+		check.Equal(2.0, limiter.hosts["host-a.asd"].limit)
+	})
+
+	t.Run("should forget idle hosts", func(t *testing.T) {
+		limiter := NewConcurrencyLimiter(1, 4, 0, 0)
+		idleRelease, _ := limiter.Acquire(newRequest(context.Background(), "https://host-a.asd"))
+		idleRelease(false)
+		busyRelease, _ := limiter.Acquire(newRequest(context.Background(), "https://host-b.asd"))
+
+		// pretend both hosts were idle since the last sweep
+		idle := time.Now().Add(-2 * hostIdleTimeout)
+		limiter.lastSweep = idle
+		for _, h := range limiter.hosts {
+			h.lastUsed = idle
+		}
+
+		release, _ := limiter.Acquire(newRequest(context.Background(), "https://host-c.asd"))
+		release(false)
+		busyRelease(false)
+		check.Len(limiter.hosts, 2, "host with in-flight attempt should be kept")
+		check.Contains(limiter.hosts, "host-b.asd")
+		check.Contains(limiter.hosts, "host-c.asd")
+	})
+}
+
+func TestRetryRoundtripperConcurrencyLimiter(t *testing.T) {
+	check := assert.New(t)
+
+	var (
+		mu          sync.Mutex
+		inFlight    int
+		maxInFlight int
+	)
+	next := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		mu.Lock()
+		inFlight++
+		if inFlight > maxInFlight {
+			maxInFlight = inFlight
+		}
+		mu.Unlock()
+
+		time.Sleep(5 * time.Millisecond)
+
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+		return FakeResponse(req, 200, []byte("ok")), nil
+	})
+
+	retryRoundtripper := &RetryRoundtripper{
+		MaxRetryCount:      3,
+		Next:               next,
+		ShouldRetry:        DefaultRetryPolicy,
+		CalculateBackoff:   ConstantBackoff(0, 0),
+		ConcurrencyLimiter: NewConcurrencyLimiter(2, 2, 100, 0),
+	}
+
+	t.Run("should limit in-flight attempts", func(t *testing.T) {
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				req, _ := http.NewRequest("GET", "https://my-super-nonexisting-url.asd", nil)
+				res, err := retryRoundtripper.RoundTrip(req)
+				check.NoError(err)
+				check.Equal(200, res.StatusCode)
+			}()
+		}
+		wg.Wait()
+
+		check.LessOrEqual(maxInFlight, 2)
+	})
+
+	t.Run("should decrease limit on overload", func(t *testing.T) {
+		limiter := NewConcurrencyLimiter(1, 8, 0, 0)
+		limiter.host("my-super-nonexisting-url.asd").limit = 8
+		retryRoundtripper.ConcurrencyLimiter = limiter
+		retryRoundtripper.Next = roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			return FakeResponse(req, http.StatusServiceUnavailable, []byte("busy")), nil
+		})
+		retryRoundtripper.MaxRetryCount = 1
+
+		req, _ := http.NewRequest("GET", "https://my-super-nonexisting-url.asd", nil)
+		res, err := retryRoundtripper.RoundTrip(req)
+
+		check.NoError(err)
+		check.Equal(http.StatusServiceUnavailable, res.StatusCode)
+		check.Equal(2.0, limiter.hosts["my-super-nonexisting-url.asd"].limit)
+	})
+}
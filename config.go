@@ -0,0 +1,386 @@
+package httpretry
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// DefaultEnvPrefix is the prefix of the environment variables read by Config.ApplyEnv()
+	DefaultEnvPrefix = "HTTPRETRY"
+)
+
+// Backoff kinds that can be used in BackoffConfig.Kind
+const (
+	BackoffKindConstant    = "constant"
+	BackoffKindLinear      = "linear"
+	BackoffKindExponential = "exponential"
+	BackoffKindMultiplier  = "multiplier"
+)
+
+// Config is a declarative retry configuration that can be decoded from JSON or YAML and bound to environment variables.
+//
+// Unset fields keep the defaults of the client. Use Options() to build the equivalent options for NewDefaultClient / NewCustomClient.
+//
+// Example (YAML):
+//
+//	maxRetries: 3
+//	backoff:
+//	  kind: exponential
+//	  minWait: 500ms
+//	  maxWait: 10s
+//	retryableStatusCodes: [429, 502, 503, 504]
+//	retryableMethods: [GET, PUT, DELETE]
+//	attemptTimeout: 5s
+//	hosts:
+//	  slow.example.com:
+//	    attemptTimeout: 30s
+type Config struct {
+	RetryConfig `yaml:",inline"`
+
+	// Hosts contains overrides for requests to specific hosts
+	Hosts map[string]RetryConfig `json:"hosts,omitempty" yaml:"hosts,omitempty"`
+}
+
+// RetryConfig contains the retry settings of a Config, either for all hosts or a specific host.
+type RetryConfig struct {
+	MaxRetries           *int           `json:"maxRetries,omitempty" yaml:"maxRetries,omitempty"`
+	Backoff              *BackoffConfig `json:"backoff,omitempty" yaml:"backoff,omitempty"`
+	RetryableStatusCodes []int          `json:"retryableStatusCodes,omitempty" yaml:"retryableStatusCodes,omitempty"`
+	RetryableMethods     []string       `json:"retryableMethods,omitempty" yaml:"retryableMethods,omitempty"`
+	AttemptTimeout       Duration       `json:"attemptTimeout,omitempty" yaml:"attemptTimeout,omitempty"`
+	MaxElapsedTime       Duration       `json:"maxElapsedTime,omitempty" yaml:"maxElapsedTime,omitempty"`
+}
+
+// BackoffConfig describes one of the backoff policies of this package.
+//
+// Unset (nil) durations keep the values of the default backoff policy: 1s minWait, 30s maxWait and 200ms maxJitter.
+// An explicit 0 is kept, e.g. a maxJitter of 0 disables the jitter and a maxWait of 0 removes the upper bound.
+type BackoffConfig struct {
+	// Kind is one of constant, linear, exponential (default) or multiplier
+	Kind                string    `json:"kind,omitempty" yaml:"kind,omitempty"`
+	MinWait             *Duration `json:"minWait,omitempty" yaml:"minWait,omitempty"`
+	MaxWait             *Duration `json:"maxWait,omitempty" yaml:"maxWait,omitempty"`
+	MaxJitter           *Duration `json:"maxJitter,omitempty" yaml:"maxJitter,omitempty"`
+	Multiplier          float64   `json:"multiplier,omitempty" yaml:"multiplier,omitempty"`
+	RandomizationFactor float64   `json:"randomizationFactor,omitempty" yaml:"randomizationFactor,omitempty"`
+}
+
+// Duration is a time.Duration that is encoded as string (e.g. "1.5s") in JSON and YAML.
+type Duration time.Duration
+
+// MarshalText implements encoding.TextMarshaler.
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (d *Duration) UnmarshalText(text []byte) error {
+	parsed, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// LoadConfigJSON decodes and validates a JSON configuration.
+func LoadConfigJSON(r io.Reader) (*Config, error) {
+	config := &Config{}
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(config); err != nil {
+		return nil, fmt.Errorf("could not decode json config: %w", err)
+	}
+	return config, config.Validate()
+}
+
+// LoadConfigYAML decodes and validates a YAML configuration.
+func LoadConfigYAML(r io.Reader) (*Config, error) {
+	config := &Config{}
+	decoder := yaml.NewDecoder(r)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(config); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("could not decode yaml config: %w", err)
+	}
+	return config, config.Validate()
+}
+
+// LoadConfigFile decodes and validates a JSON (.json) or YAML (.yaml, .yml) configuration file.
+func LoadConfigFile(path string) (*Config, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return LoadConfigJSON(file)
+	case ".yaml", ".yml":
+		return LoadConfigYAML(file)
+	default:
+		return nil, fmt.Errorf("unsupported config file extension: %s", path)
+	}
+}
+
+// ApplyEnv overrides the configuration with the values of the following environment variables (prefix defaults to HTTPRETRY):
+//
+//	<prefix>_MAX_RETRIES                   e.g. 3
+//	<prefix>_BACKOFF_KIND                  e.g. exponential
+//	<prefix>_BACKOFF_MIN_WAIT              e.g. 500ms
+//	<prefix>_BACKOFF_MAX_WAIT              e.g. 10s
+//	<prefix>_BACKOFF_MAX_JITTER            e.g. 100ms
+//	<prefix>_BACKOFF_MULTIPLIER            e.g. 1.5
+//	<prefix>_BACKOFF_RANDOMIZATION_FACTOR  e.g. 0.2
+//	<prefix>_RETRYABLE_STATUS_CODES        e.g. 429,502,503
+//	<prefix>_RETRYABLE_METHODS             e.g. GET,PUT
+//	<prefix>_ATTEMPT_TIMEOUT               e.g. 5s
+//	<prefix>_MAX_ELAPSED_TIME              e.g. 2m
+//
+// The resulting configuration is validated.
+func (c *Config) ApplyEnv(prefix string) error {
+	if prefix == "" {
+		prefix = DefaultEnvPrefix
+	}
+	env := func(name string) (string, bool) {
+		value, ok := os.LookupEnv(prefix + "_" + name)
+		return strings.TrimSpace(value), ok && strings.TrimSpace(value) != ""
+	}
+	backoff := func() *BackoffConfig {
+		if c.Backoff == nil {
+			c.Backoff = &BackoffConfig{}
+		}
+		return c.Backoff
+	}
+
+	if value, ok := env("MAX_RETRIES"); ok {
+		maxRetries, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%s_MAX_RETRIES: %w", prefix, err)
+		}
+		c.MaxRetries = &maxRetries
+	}
+	if value, ok := env("BACKOFF_KIND"); ok {
+		backoff().Kind = value
+	}
+	durations := map[string]func(d Duration){
+		"BACKOFF_MIN_WAIT":   func(d Duration) { backoff().MinWait = &d },
+		"BACKOFF_MAX_WAIT":   func(d Duration) { backoff().MaxWait = &d },
+		"BACKOFF_MAX_JITTER": func(d Duration) { backoff().MaxJitter = &d },
+		"ATTEMPT_TIMEOUT":    func(d Duration) { c.AttemptTimeout = d },
+		"MAX_ELAPSED_TIME":   func(d Duration) { c.MaxElapsedTime = d },
+	}
+	for name, set := range durations {
+		if value, ok := env(name); ok {
+			var d Duration
+			if err := d.UnmarshalText([]byte(value)); err != nil {
+				return fmt.Errorf("%s_%s: %w", prefix, name, err)
+			}
+			set(d)
+		}
+	}
+	floats := map[string]func(f float64){
+		"BACKOFF_MULTIPLIER":           func(f float64) { backoff().Multiplier = f },
+		"BACKOFF_RANDOMIZATION_FACTOR": func(f float64) { backoff().RandomizationFactor = f },
+	}
+	for name, set := range floats {
+		if value, ok := env(name); ok {
+			f, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return fmt.Errorf("%s_%s: %w", prefix, name, err)
+			}
+			set(f)
+		}
+	}
+	if value, ok := env("RETRYABLE_STATUS_CODES"); ok {
+		var codes []int
+		for _, field := range splitList(value) {
+			code, err := strconv.Atoi(field)
+			if err != nil {
+				return fmt.Errorf("%s_RETRYABLE_STATUS_CODES: %w", prefix, err)
+			}
+			codes = append(codes, code)
+		}
+		c.RetryableStatusCodes = codes
+	}
+	if value, ok := env("RETRYABLE_METHODS"); ok {
+		c.RetryableMethods = splitList(value)
+	}
+
+	return c.Validate()
+}
+
+// Validate checks the configuration for invalid values.
+func (c *Config) Validate() error {
+	if err := c.RetryConfig.validate(""); err != nil {
+		return err
+	}
+	for host, hostConfig := range c.Hosts {
+		if host == "" {
+			return errors.New("hosts: host must not be empty")
+		}
+		if err := hostConfig.validate("hosts[" + host + "]."); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Options validates the configuration and returns the equivalent options for NewDefaultClient / NewCustomClient.
+func (c *Config) Options() ([]Option, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+
+	opts := c.RetryConfig.options()
+	for host, hostConfig := range c.Hosts {
+		opts = append(opts, WithHostOptions(host, hostConfig.options()...))
+	}
+	return opts, nil
+}
+
+// validate checks the retry settings, prefix is prepended to the field names in errors.
+func (c *RetryConfig) validate(prefix string) error {
+	if c.MaxRetries != nil && *c.MaxRetries < 0 {
+		return fmt.Errorf("%smaxRetries: must not be negative", prefix)
+	}
+	if c.Backoff != nil {
+		if err := c.Backoff.validate(prefix + "backoff."); err != nil {
+			return err
+		}
+	}
+	for _, code := range c.RetryableStatusCodes {
+		if code < 100 || code > 599 {
+			return fmt.Errorf("%sretryableStatusCodes: invalid status code %d", prefix, code)
+		}
+	}
+	for _, method := range c.RetryableMethods {
+		if method == "" || strings.ContainsAny(method, " \t,") {
+			return fmt.Errorf("%sretryableMethods: invalid method %q", prefix, method)
+		}
+	}
+	if c.AttemptTimeout < 0 {
+		return fmt.Errorf("%sattemptTimeout: must not be negative", prefix)
+	}
+	if c.MaxElapsedTime < 0 {
+		return fmt.Errorf("%smaxElapsedTime: must not be negative", prefix)
+	}
+	return nil
+}
+
+// options returns the options for all configured settings.
+func (c *RetryConfig) options() []Option {
+	var opts []Option
+	if c.MaxRetries != nil {
+		opts = append(opts, WithMaxRetryCount(*c.MaxRetries))
+	}
+	if c.Backoff != nil {
+		opts = append(opts,
+			WithBackoffPolicy(c.Backoff.policy()),
+			WithPolicyLabels(PolicyLabels{BackoffPolicy: c.Backoff.label()}),
+		)
+	}
+	if len(c.RetryableStatusCodes) > 0 {
+		opts = append(opts,
+			WithRetryPolicy(defaultRetryPolicyWithStatus(c.RetryableStatusCodes...)),
+			WithPolicyLabels(PolicyLabels{RetryPolicy: fmt.Sprintf("DefaultRetryPolicy with status codes %v", c.RetryableStatusCodes)}),
+		)
+	}
+	if len(c.RetryableMethods) > 0 {
+		opts = append(opts, WithRetryableMethods(c.RetryableMethods...))
+	}
+	if c.AttemptTimeout > 0 {
+		opts = append(opts, WithAttemptTimeout(time.Duration(c.AttemptTimeout)))
+	}
+	if c.MaxElapsedTime > 0 {
+		opts = append(opts, WithMaxElapsedTime(time.Duration(c.MaxElapsedTime)))
+	}
+	return opts
+}
+
+// validate checks the backoff settings, prefix is prepended to the field names in errors.
+func (c *BackoffConfig) validate(prefix string) error {
+	switch c.Kind {
+	case "", BackoffKindConstant, BackoffKindLinear, BackoffKindExponential, BackoffKindMultiplier:
+	default:
+		return fmt.Errorf("%skind: unknown backoff kind %q", prefix, c.Kind)
+	}
+	minWait, maxWait, maxJitter := c.durations()
+	switch {
+	case minWait < 0:
+		return fmt.Errorf("%sminWait: must not be negative", prefix)
+	case maxWait < 0:
+		return fmt.Errorf("%smaxWait: must not be negative", prefix)
+	case maxWait > 0 && maxWait < minWait:
+		return fmt.Errorf("%smaxWait: must not be less than minWait", prefix)
+	case maxJitter < 0:
+		return fmt.Errorf("%smaxJitter: must not be negative", prefix)
+	case c.Kind == BackoffKindMultiplier && c.Multiplier < 1:
+		return fmt.Errorf("%smultiplier: must be >= 1", prefix)
+	case c.RandomizationFactor < 0 || c.RandomizationFactor > 1:
+		return fmt.Errorf("%srandomizationFactor: must be between 0 and 1", prefix)
+	}
+	return nil
+}
+
+// durations returns the durations of the settings, the unset ones are taken from the default backoff policy.
+func (c *BackoffConfig) durations() (minWait time.Duration, maxWait time.Duration, maxJitter time.Duration) {
+	orDefault := func(d *Duration, defaultValue time.Duration) time.Duration {
+		if d == nil {
+			return defaultValue
+		}
+		return time.Duration(*d)
+	}
+	return orDefault(c.MinWait, defaultMinWait), orDefault(c.MaxWait, defaultMaxWait), orDefault(c.MaxJitter, defaultMaxJitter)
+}
+
+// policy returns the described backoff policy, unset durations keep the defaults (1s minWait, 30s maxWait, 200ms jitter).
+func (c *BackoffConfig) policy() BackoffPolicy {
+	minWait, maxWait, maxJitter := c.durations()
+	switch c.Kind {
+	case BackoffKindConstant:
+		return ConstantBackoff(minWait, maxJitter)
+	case BackoffKindLinear:
+		return LinearBackoff(minWait, maxWait, maxJitter)
+	case BackoffKindMultiplier:
+		return MultiplierBackoff(minWait, maxWait, c.Multiplier, c.RandomizationFactor)
+	default:
+		return ExponentialBackoff(minWait, maxWait, maxJitter)
+	}
+}
+
+// label describes the backoff policy for Describe().
+func (c *BackoffConfig) label() string {
+	minWait, maxWait, maxJitter := c.durations()
+	switch c.Kind {
+	case BackoffKindConstant:
+		return fmt.Sprintf("ConstantBackoff(%s, %s)", minWait, maxJitter)
+	case BackoffKindLinear:
+		return fmt.Sprintf("LinearBackoff(%s, %s, %s)", minWait, maxWait, maxJitter)
+	case BackoffKindMultiplier:
+		return fmt.Sprintf("MultiplierBackoff(%s, %s, %g, %g)", minWait, maxWait, c.Multiplier, c.RandomizationFactor)
+	default:
+		return fmt.Sprintf("ExponentialBackoff(%s, %s, %s)", minWait, maxWait, maxJitter)
+	}
+}
+
+// splitList splits a comma separated list and trims the elements.
+func splitList(value string) []string {
+	var list []string
+	for _, field := range strings.Split(value, ",") {
+		if field = strings.TrimSpace(field); field != "" {
+			list = append(list, field)
+		}
+	}
+	return list
+}
@@ -0,0 +1,295 @@
+package httpretry
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadConfig(t *testing.T) {
+	check := assert.New(t)
+
+	t.Run("should decode json", func(t *testing.T) {
+		config, err := LoadConfigJSON(strings.NewReader(`{
+			"maxRetries": 3,
+			"backoff": {"kind": "multiplier", "minWait": "500ms", "maxWait": "10s", "multiplier": 1.5, "randomizationFactor": 0.2},
+			"retryableStatusCodes": [429, 503],
+			"retryableMethods": ["GET", "PUT"],
+			"attemptTimeout": "5s",
+			"hosts": {"slow.example.com": {"attemptTimeout": "30s"}}
+		}`))
+
+		check.NoError(err)
+		check.Equal(3, *config.MaxRetries)
+		check.Equal(BackoffKindMultiplier, config.Backoff.Kind)
+		check.Equal(Duration(500*time.Millisecond), *config.Backoff.MinWait)
+		check.Equal(1.5, config.Backoff.Multiplier)
+		check.Equal([]int{429, 503}, config.RetryableStatusCodes)
+		check.Equal([]string{"GET", "PUT"}, config.RetryableMethods)
+		check.Equal(Duration(5*time.Second), config.AttemptTimeout)
+		check.Equal(Duration(30*time.Second), config.Hosts["slow.example.com"].AttemptTimeout)
+	})
+
+	t.Run("should decode yaml", func(t *testing.T) {
+		config, err := LoadConfigYAML(strings.NewReader(`
+maxRetries: 0
+backoff:
+  kind: constant
+  minWait: 2s
+retryableStatusCodes: [502]
+hosts:
+  api.example.com:
+    maxRetries: 7
+`))
+
+		check.NoError(err)
+		check.Equal(0, *config.MaxRetries)
+		check.Equal(BackoffKindConstant, config.Backoff.Kind)
+		check.Equal(Duration(2*time.Second), *config.Backoff.MinWait)
+		check.Equal([]int{502}, config.RetryableStatusCodes)
+		check.Equal(7, *config.Hosts["api.example.com"].MaxRetries)
+	})
+
+	t.Run("should accept empty yaml", func(t *testing.T) {
+		config, err := LoadConfigYAML(strings.NewReader(""))
+
+		check.NoError(err)
+		check.Nil(config.MaxRetries)
+	})
+
+	t.Run("should reject unknown fields", func(t *testing.T) {
+		_, err := LoadConfigJSON(strings.NewReader(`{"maxRetry": 3}`))
+		check.Error(err)
+
+		_, err = LoadConfigYAML(strings.NewReader(`maxRetry: 3`))
+		check.Error(err)
+	})
+
+	t.Run("should reject invalid durations", func(t *testing.T) {
+		_, err := LoadConfigJSON(strings.NewReader(`{"attemptTimeout": "5 seconds"}`))
+		check.Error(err)
+	})
+
+	t.Run("should load file by extension", func(t *testing.T) {
+		dir := t.TempDir()
+		jsonPath := filepath.Join(dir, "retry.json")
+		yamlPath := filepath.Join(dir, "retry.yml")
+		check.NoError(os.WriteFile(jsonPath, []byte(`{"maxRetries": 1}`), 0o600))
+		check.NoError(os.WriteFile(yamlPath, []byte(`maxRetries: 2`), 0o600))
+
+		config, err := LoadConfigFile(jsonPath)
+		check.NoError(err)
+		check.Equal(1, *config.MaxRetries)
+
+		config, err = LoadConfigFile(yamlPath)
+		check.NoError(err)
+		check.Equal(2, *config.MaxRetries)
+
+		_, err = LoadConfigFile(filepath.Join(dir, "retry.toml"))
+		check.Error(err)
+	})
+}
+
+func TestConfigApplyEnv(t *testing.T) {
+	check := assert.New(t)
+
+	t.Run("should override config with environment variables", func(t *testing.T) {
+		t.Setenv("HTTPRETRY_MAX_RETRIES", "4")
+		t.Setenv("HTTPRETRY_BACKOFF_KIND", "linear")
+		t.Setenv("HTTPRETRY_BACKOFF_MIN_WAIT", "1s")
+		t.Setenv("HTTPRETRY_BACKOFF_MAX_WAIT", "5s")
+		t.Setenv("HTTPRETRY_RETRYABLE_STATUS_CODES", "429, 503")
+		t.Setenv("HTTPRETRY_RETRYABLE_METHODS", "GET,HEAD")
+		t.Setenv("HTTPRETRY_ATTEMPT_TIMEOUT", "3s")
+		t.Setenv("HTTPRETRY_MAX_ELAPSED_TIME", "2m")
+
+		maxRetries := 1
+		config := &Config{RetryConfig: RetryConfig{MaxRetries: &maxRetries}}
+		check.NoError(config.ApplyEnv(""))
+
+		check.Equal(4, *config.MaxRetries)
+		check.Equal(BackoffKindLinear, config.Backoff.Kind)
+		check.Equal(Duration(1*time.Second), *config.Backoff.MinWait)
+		check.Equal(Duration(5*time.Second), *config.Backoff.MaxWait)
+		check.Equal([]int{429, 503}, config.RetryableStatusCodes)
+		check.Equal([]string{"GET", "HEAD"}, config.RetryableMethods)
+		check.Equal(Duration(3*time.Second), config.AttemptTimeout)
+		check.Equal(Duration(2*time.Minute), config.MaxElapsedTime)
+	})
+
+	t.Run("should use custom prefix", func(t *testing.T) {
+		t.Setenv("MYAPP_MAX_RETRIES", "9")
+
+		config := &Config{}
+		check.NoError(config.ApplyEnv("MYAPP"))
+		check.Equal(9, *config.MaxRetries)
+	})
+
+	t.Run("should return parse errors", func(t *testing.T) {
+		t.Setenv("HTTPRETRY_MAX_RETRIES", "many")
+
+		err := (&Config{}).ApplyEnv("")
+		check.ErrorContains(err, "HTTPRETRY_MAX_RETRIES")
+	})
+
+	t.Run("should validate result", func(t *testing.T) {
+		t.Setenv("HTTPRETRY_MAX_RETRIES", "-1")
+
+		err := (&Config{}).ApplyEnv("")
+		check.ErrorContains(err, "maxRetries")
+	})
+}
+
+func TestConfigValidate(t *testing.T) {
+	check := assert.New(t)
+
+	negative := -1
+	tests := []struct {
+		Description string
+		Config      Config
+		Expect      string
+	}{
+		{"negative max retries", Config{RetryConfig: RetryConfig{MaxRetries: &negative}}, "maxRetries"},
+		{"unknown backoff kind", Config{RetryConfig: RetryConfig{Backoff: &BackoffConfig{Kind: "fibonacci"}}}, "backoff.kind"},
+		{"maxWait < minWait", Config{RetryConfig: RetryConfig{Backoff: &BackoffConfig{MinWait: durationPtr(2 * time.Second), MaxWait: durationPtr(time.Second)}}}, "backoff.maxWait"},
+		{"multiplier < 1", Config{RetryConfig: RetryConfig{Backoff: &BackoffConfig{Kind: BackoffKindMultiplier, Multiplier: 0.5}}}, "backoff.multiplier"},
+		{"randomization factor > 1", Config{RetryConfig: RetryConfig{Backoff: &BackoffConfig{RandomizationFactor: 2}}}, "backoff.randomizationFactor"},
+		{"invalid status code", Config{RetryConfig: RetryConfig{RetryableStatusCodes: []int{1000}}}, "retryableStatusCodes"},
+		{"invalid method", Config{RetryConfig: RetryConfig{RetryableMethods: []string{"GET PUT"}}}, "retryableMethods"},
+		{"negative attempt timeout", Config{RetryConfig: RetryConfig{AttemptTimeout: -1}}, "attemptTimeout"},
+		{"negative max elapsed time", Config{RetryConfig: RetryConfig{MaxElapsedTime: -1}}, "maxElapsedTime"},
+		{"invalid host config", Config{Hosts: map[string]RetryConfig{"a.com": {MaxRetries: &negative}}}, "hosts[a.com].maxRetries"},
+		{"empty host", Config{Hosts: map[string]RetryConfig{"": {}}}, "hosts"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Description, func(t *testing.T) {
+			check.ErrorContains(test.Config.Validate(), test.Expect)
+
+			_, err := test.Config.Options()
+			check.Error(err)
+		})
+	}
+
+	t.Run("empty config should be valid", func(t *testing.T) {
+		check.NoError((&Config{}).Validate())
+	})
+
+	t.Run("maxWait is compared with default minWait", func(t *testing.T) {
+		config := Config{RetryConfig: RetryConfig{Backoff: &BackoffConfig{MaxWait: durationPtr(500 * time.Millisecond)}}}
+		check.ErrorContains(config.Validate(), "backoff.maxWait")
+	})
+}
+
+func TestBackoffConfigDefaults(t *testing.T) {
+	check := assert.New(t)
+
+	t.Run("should keep default durations for partial backoff", func(t *testing.T) {
+		policy := (&BackoffConfig{Kind: BackoffKindExponential}).policy()
+
+		check.GreaterOrEqual(policy(1), defaultMinWait)
+		check.Less(policy(1), defaultMinWait+defaultMaxJitter)
+		check.GreaterOrEqual(policy(20), defaultMaxWait)
+		check.Less(policy(20), defaultMaxWait+defaultMaxJitter)
+	})
+
+	t.Run("should keep default minWait if only maxWait is set", func(t *testing.T) {
+		policy := (&BackoffConfig{MaxWait: durationPtr(10 * time.Second)}).policy()
+
+		check.GreaterOrEqual(policy(1), defaultMinWait)
+		check.GreaterOrEqual(policy(20), 10*time.Second)
+		check.Less(policy(20), 10*time.Second+defaultMaxJitter)
+	})
+
+	t.Run("should keep explicit zero durations", func(t *testing.T) {
+		config, err := LoadConfigYAML(strings.NewReader("backoff:\n  kind: constant\n  minWait: 1s\n  maxJitter: 0s\n"))
+		check.NoError(err)
+		check.Equal(Duration(0), *config.Backoff.MaxJitter)
+		check.Nil(config.Backoff.MaxWait)
+		check.Equal("ConstantBackoff(1s, 0s)", config.Backoff.label())
+		for i := 1; i < 5; i++ {
+			check.Equal(time.Second, config.Backoff.policy()(i), "should not add jitter")
+		}
+
+		policy := (&BackoffConfig{MaxWait: durationPtr(0), MaxJitter: durationPtr(0)}).policy()
+		check.Greater(policy(20), defaultMaxWait, "should not limit maxWait")
+	})
+
+	t.Run("should keep explicit zero durations from env", func(t *testing.T) {
+		t.Setenv("HTTPRETRY_BACKOFF_MAX_JITTER", "0s")
+
+		config := &Config{}
+		check.NoError(config.ApplyEnv(""))
+		check.Equal(Duration(0), *config.Backoff.MaxJitter)
+		check.Equal("ExponentialBackoff(1s, 30s, 0s)", config.Backoff.label())
+	})
+}
+
+// durationPtr returns a pointer to the duration.
+func durationPtr(d time.Duration) *Duration {
+	value := Duration(d)
+	return &value
+}
+
+func TestConfigOptions(t *testing.T) {
+	check := assert.New(t)
+
+	config, err := LoadConfigJSON(strings.NewReader(`{
+		"maxRetries": 2,
+		"backoff": {"kind": "constant", "minWait": "1ms"},
+		"retryableStatusCodes": [418],
+		"retryableMethods": ["GET"],
+		"hosts": {"other.asd": {"maxRetries": 0}}
+	}`))
+	check.NoError(err)
+
+	opts, err := config.Options()
+	check.NoError(err)
+
+	mockRoundtripper := &MockRoundtripper{
+		RoundTripFunc: func(req *http.Request, called int) (*http.Response, error) {
+			return FakeResponse(req, http.StatusTeapot, []byte("teapot")), nil
+		},
+	}
+	client := NewCustomClient(&http.Client{Transport: mockRoundtripper}, opts...)
+	rt := client.Transport.(*RetryRoundtripper)
+
+	check.Equal(2, rt.MaxRetryCount)
+	check.Equal("ConstantBackoff(1ms, 200ms)", rt.Labels.BackoffPolicy)
+	check.Equal("DefaultRetryPolicy with status codes [418]", rt.Labels.RetryPolicy)
+	check.GreaterOrEqual(rt.CalculateBackoff(5), 1*time.Millisecond)
+	check.Less(rt.CalculateBackoff(5), 1*time.Millisecond+defaultMaxJitter, "unset maxJitter should keep the default")
+	check.True(rt.ShouldRetry(http.StatusTeapot, nil))
+	check.False(rt.ShouldRetry(http.StatusServiceUnavailable, nil))
+
+	t.Run("should retry configured methods", func(t *testing.T) {
+		mockRoundtripper.CallCount = 0
+		req, _ := http.NewRequest("GET", "https://my-super-nonexisting-url.asd", nil)
+		_, err := rt.RoundTrip(req)
+
+		check.NoError(err)
+		check.Equal(3, mockRoundtripper.CallCount)
+	})
+
+	t.Run("should not retry other methods", func(t *testing.T) {
+		mockRoundtripper.CallCount = 0
+		req, _ := http.NewRequest("POST", "https://my-super-nonexisting-url.asd", nil)
+		_, err := rt.RoundTrip(req)
+
+		check.NoError(err)
+		check.Equal(1, mockRoundtripper.CallCount)
+	})
+
+	t.Run("should apply host overrides", func(t *testing.T) {
+		mockRoundtripper.CallCount = 0
+		req, _ := http.NewRequest("GET", "https://other.asd:8443/path", nil)
+		_, err := rt.RoundTrip(req)
+
+		check.NoError(err)
+		check.Equal(1, mockRoundtripper.CallCount)
+	})
+}
@@ -0,0 +1,37 @@
+package httpretry
+
+import (
+	"context"
+	"time"
+)
+
+// disableRetriesKey is the context key of DisableRetries
+type disableRetriesKey struct{}
+
+// DisableRetries returns a context that disables the retries of the retry roundtripper for requests with this context.
+//
+// This is useful for requests that are retried by the caller itself (e.g. resumable uploads),
+// all other features (rate limiting, attempt timeout etc.) still apply.
+//
+// Example:
+//
+//	req, _ := http.NewRequestWithContext(httpretry.DisableRetries(ctx), "POST", url, body)
+func DisableRetries(ctx context.Context) context.Context {
+	return context.WithValue(ctx, disableRetriesKey{}, true)
+}
+
+// retriesDisabled checks if retries were disabled with DisableRetries.
+func retriesDisabled(ctx context.Context) bool {
+	disabled, _ := ctx.Value(disableRetriesKey{}).(bool)
+	return disabled
+}
+
+// detachedContext keeps the values of its parent, but is never canceled and has no deadline.
+type detachedContext struct {
+	parent context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool)         { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}               { return nil }
+func (detachedContext) Err() error                          { return nil }
+func (c detachedContext) Value(key interface{}) interface{} { return c.parent.Value(key) }
@@ -0,0 +1,386 @@
+package httpretry
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// PolicyLabels are reported by Describe() instead of the function names of the policies.
+type PolicyLabels struct {
+	RetryPolicy           string `json:"retryPolicy,omitempty"`
+	BackoffPolicy         string `json:"backoffPolicy,omitempty"`
+	ResponseBackoffPolicy string `json:"responseBackoffPolicy,omitempty"`
+	BodyRetryPolicy       string `json:"bodyRetryPolicy,omitempty"`
+	DrainStrategy         string `json:"drainStrategy,omitempty"`
+	RedirectPolicy        string `json:"redirectPolicy,omitempty"`
+	PrepareAttempt        string `json:"prepareAttempt,omitempty"`
+}
+
+// defaultPolicyLabels describe the default policies of newRetryRoundtripper
+var defaultPolicyLabels = PolicyLabels{
+	RetryPolicy:   "DefaultRetryPolicy",
+	BackoffPolicy: fmt.Sprintf("ExponentialBackoff(%s, %s, %s)", defaultMinWait, defaultMaxWait, defaultMaxJitter),
+}
+
+// numPolicyLabels is the number of labels in PolicyLabels
+const numPolicyLabels = 7
+
+// fields returns pointers to the labels, in the order of RetryRoundtripper.labeledPolicies().
+func (l *PolicyLabels) fields() [numPolicyLabels]*string {
+	return [numPolicyLabels]*string{
+		&l.RetryPolicy,
+		&l.BackoffPolicy,
+		&l.ResponseBackoffPolicy,
+		&l.BodyRetryPolicy,
+		&l.DrainStrategy,
+		&l.RedirectPolicy,
+		&l.PrepareAttempt,
+	}
+}
+
+// labeledPolicies returns the policies that can be labeled, in the order of PolicyLabels.fields().
+func (r *RetryRoundtripper) labeledPolicies() [numPolicyLabels]interface{} {
+	return [numPolicyLabels]interface{}{
+		r.ShouldRetry,
+		r.CalculateBackoff,
+		r.CalculateResponseBackoff,
+		r.ShouldRetryBody,
+		r.DrainBody,
+		r.CheckRedirect,
+		r.PrepareAttempt,
+	}
+}
+
+// setLabels sets the non-empty labels and remembers the policies they were set for.
+func (r *RetryRoundtripper) setLabels(labels PolicyLabels) {
+	dst, src, policies := r.Labels.fields(), labels.fields(), r.labeledPolicies()
+	for i := range dst {
+		if *src[i] != "" {
+			*dst[i] = *src[i]
+			r.labeledFuncs[i] = funcPointer(policies[i])
+		}
+	}
+}
+
+// labels returns the labels of the policies that were not replaced since they were labeled with setLabels.
+//
+// Labels that were set directly on the Labels field are always reported.
+// Functions are compared by their code pointer, so replacing a policy with another one of the same
+// constructor (e.g. ConstantBackoff with different arguments) is not detected.
+func (r *RetryRoundtripper) labels() PolicyLabels {
+	labels := r.Labels
+	fields, policies := labels.fields(), r.labeledPolicies()
+	for i := range fields {
+		if r.labeledFuncs[i] != 0 && r.labeledFuncs[i] != funcPointer(policies[i]) {
+			*fields[i] = ""
+		}
+	}
+	return labels
+}
+
+// Description reports the effective settings of a retry roundtripper in a human readable (String()) and JSON form.
+//
+// Policies are functions, so they are described by their labels (see WithPolicyLabels), by the name of the constructor
+// of this package that created them (e.g. "Any(...)"), or by their function names.
+// Policies are never called to describe them.
+type Description struct {
+	Next                  string                 `json:"next"`
+	MaxRetryCount         int                    `json:"maxRetryCount"`
+	RetryPolicy           string                 `json:"retryPolicy"`
+	BackoffPolicy         string                 `json:"backoffPolicy"`
+	ResponseBackoffPolicy string                 `json:"responseBackoffPolicy,omitempty"`
+	BodyRetryPolicy       string                 `json:"bodyRetryPolicy,omitempty"`
+	BodyPeekLimit         int64                  `json:"bodyPeekLimit,omitempty"`
+	RateLimiter           bool                   `json:"rateLimiter"`
+	ConcurrencyLimiter    bool                   `json:"concurrencyLimiter"`
+	PauseGate             bool                   `json:"pauseGate"`
+	TokenAuth             bool                   `json:"tokenAuth"`
+	BodyReadMode          string                 `json:"bodyReadMode"`
+	BodyBufferLimit       int64                  `json:"bodyBufferLimit,omitempty"`
+	DrainStrategy         string                 `json:"drainStrategy,omitempty"`
+	CaptureFailedAttempts bool                   `json:"captureFailedAttempts"`
+	FollowRedirects       bool                   `json:"followRedirects"`
+	MaxRedirects          int                    `json:"maxRedirects,omitempty"`
+	RedirectPolicy        string                 `json:"redirectPolicy,omitempty"`
+	RetryableMethods      []string               `json:"retryableMethods,omitempty"`
+	AttemptTimeout        Duration               `json:"attemptTimeout,omitempty"`
+	MaxElapsedTime        Duration               `json:"maxElapsedTime,omitempty"`
+	MaxBufferedBodySize   int64                  `json:"maxBufferedBodySize,omitempty"`
+	PrepareAttempt        string                 `json:"prepareAttempt,omitempty"`
+	AttemptHeader         string                 `json:"attemptHeader,omitempty"`
+	Hosts                 map[string]Description `json:"hosts,omitempty"`
+}
+
+// String returns the description in a human readable form.
+func (d Description) String() string {
+	var sb strings.Builder
+	d.write(&sb, "")
+	return sb.String()
+}
+
+// write writes the description with the given indentation.
+func (d Description) write(sb *strings.Builder, indent string) {
+	line := func(name string, value interface{}) {
+		fmt.Fprintf(sb, "%s%-26s%v\n", indent, name+":", value)
+	}
+
+	line("next", d.Next)
+	line("max retry count", d.MaxRetryCount)
+	if d.MaxElapsedTime > 0 {
+		line("max elapsed time", time.Duration(d.MaxElapsedTime))
+	}
+	if d.MaxBufferedBodySize > 0 {
+		line("max buffered body size", d.MaxBufferedBodySize)
+	}
+	line("retry policy", d.RetryPolicy)
+	line("backoff policy", d.BackoffPolicy)
+	if d.ResponseBackoffPolicy != "" {
+		line("response backoff policy", d.ResponseBackoffPolicy)
+	}
+	if d.BodyRetryPolicy != "" {
+		line("body retry policy", fmt.Sprintf("%s (peek %d bytes)", d.BodyRetryPolicy, d.BodyPeekLimit))
+	}
+	line("rate limiter", d.RateLimiter)
+	line("concurrency limiter", d.ConcurrencyLimiter)
+	line("pause gate", d.PauseGate)
+	line("token auth", d.TokenAuth)
+	if d.BodyReadMode == BodyReadBuffered.String() {
+		line("body read mode", fmt.Sprintf("%s (%d bytes)", d.BodyReadMode, d.BodyBufferLimit))
+	} else {
+		line("body read mode", d.BodyReadMode)
+	}
+	if d.DrainStrategy != "" {
+		line("drain strategy", d.DrainStrategy)
+	}
+	line("capture failed attempts", d.CaptureFailedAttempts)
+	if d.FollowRedirects {
+		line("follow redirects", fmt.Sprintf("max %d", d.MaxRedirects))
+	}
+	if d.RedirectPolicy != "" {
+		line("redirect policy", d.RedirectPolicy)
+	}
+	if len(d.RetryableMethods) > 0 {
+		line("retryable methods", strings.Join(d.RetryableMethods, ","))
+	}
+	if d.AttemptTimeout > 0 {
+		line("attempt timeout", time.Duration(d.AttemptTimeout))
+	}
+	if d.PrepareAttempt != "" {
+		line("prepare attempt", d.PrepareAttempt)
+	}
+	if d.AttemptHeader != "" {
+		line("attempt header", d.AttemptHeader)
+	}
+
+	hosts := make([]string, 0, len(d.Hosts))
+	for host := range d.Hosts {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	for _, host := range hosts {
+		fmt.Fprintf(sb, "%shost %s:\n", indent, host)
+		d.Hosts[host].write(sb, indent+"  ")
+	}
+}
+
+// Describe reports the effective settings of the retry roundtripper, including the overrides per host.
+//
+// Labels of policies that were replaced directly (not with an option) since they were labeled are not reported.
+func (r *RetryRoundtripper) Describe() Description {
+	config := r.snapshot()
+
+	d := config.describe()
+	for host, opts := range config.hostOptions {
+		if d.Hosts == nil {
+			d.Hosts = make(map[string]Description)
+		}
+		d.Hosts[host] = config.withOptions(opts).describe()
+	}
+	return d
+}
+
+// describe reports the settings without the overrides per host.
+func (r *RetryRoundtripper) describe() Description {
+	labels := r.labels()
+	d := Description{
+		Next:                  typeName(r.Next),
+		MaxRetryCount:         r.MaxRetryCount,
+		RetryPolicy:           labeledFuncName(labels.RetryPolicy, r.ShouldRetry),
+		BackoffPolicy:         labeledFuncName(labels.BackoffPolicy, r.CalculateBackoff),
+		ResponseBackoffPolicy: optionalFuncName(labels.ResponseBackoffPolicy, r.CalculateResponseBackoff),
+		BodyRetryPolicy:       optionalFuncName(labels.BodyRetryPolicy, r.ShouldRetryBody),
+		RateLimiter:           r.RateLimiter != nil,
+		ConcurrencyLimiter:    r.ConcurrencyLimiter != nil,
+		PauseGate:             r.PauseGate != nil,
+		TokenAuth:             r.TokenAuth != nil,
+		BodyReadMode:          r.BodyReadMode.String(),
+		DrainStrategy:         optionalFuncName(labels.DrainStrategy, r.DrainBody),
+		CaptureFailedAttempts: r.CaptureFailedAttempts,
+		FollowRedirects:       r.FollowRedirects,
+		MaxRedirects:          r.MaxRedirects,
+		RedirectPolicy:        optionalFuncName(labels.RedirectPolicy, r.CheckRedirect),
+		RetryableMethods:      r.RetryableMethods,
+		AttemptTimeout:        Duration(r.AttemptTimeout),
+		MaxElapsedTime:        Duration(r.MaxElapsedTime),
+		MaxBufferedBodySize:   r.MaxBufferedBodySize,
+		PrepareAttempt:        optionalFuncName(labels.PrepareAttempt, r.PrepareAttempt),
+		AttemptHeader:         r.AttemptHeader,
+	}
+	if r.ShouldRetryBody != nil {
+		d.BodyPeekLimit = r.BodyPeekLimit
+	}
+
+	return d
+}
+
+// Validate checks the configuration of the retry roundtripper, including the overrides per host.
+func (r *RetryRoundtripper) Validate() error {
+	config := r.snapshot()
+
+	if err := config.validate(); err != nil {
+		return err
+	}
+	for host, opts := range config.hostOptions {
+		if err := config.withOptions(opts).validate(); err != nil {
+			return fmt.Errorf("host %s: %w", host, err)
+		}
+	}
+	return nil
+}
+
+// validate checks the configuration without the overrides per host.
+func (r *RetryRoundtripper) validate() error {
+	switch {
+	case r.Next == nil:
+		return errors.New("next roundtripper must not be nil")
+	case r.ShouldRetry == nil:
+		return errors.New("retry policy must not be nil")
+	case r.CalculateBackoff == nil && r.CalculateResponseBackoff == nil:
+		return errors.New("backoff policy must not be nil")
+	case r.MaxRetryCount < 0:
+		return errors.New("max retry count must not be negative")
+	case r.AttemptTimeout < 0:
+		return errors.New("attempt timeout must not be negative")
+	case r.MaxElapsedTime < 0:
+		return errors.New("max elapsed time must not be negative")
+	case r.MaxBufferedBodySize < 0:
+		return errors.New("max buffered body size must not be negative")
+	}
+	return nil
+}
+
+// typeName returns the type name of the value or <nil>.
+func typeName(value interface{}) string {
+	if value == nil {
+		return "<nil>"
+	}
+	return reflect.TypeOf(value).String()
+}
+
+// funcName returns the name of the function or <nil>.
+//
+// Policies created by a constructor of this package are named after the constructor (e.g. "Any(...)"),
+// other functions by their name without the import path (e.g. "main.myPolicy").
+func funcName(f interface{}) string {
+	v := reflect.ValueOf(f)
+	if v.Kind() != reflect.Func || v.IsNil() {
+		return "<nil>"
+	}
+	if name, ok := builtinFuncName(v.Pointer()); ok {
+		return name
+	}
+	if fn := runtime.FuncForPC(v.Pointer()); fn != nil {
+		name := fn.Name()
+		if i := strings.LastIndexByte(name, '/'); i >= 0 {
+			name = name[i+1:]
+		}
+		return name
+	}
+	return v.Type().String()
+}
+
+// funcPointer returns the code pointer of the function, or 0 if it is nil.
+func funcPointer(f interface{}) uintptr {
+	v := reflect.ValueOf(f)
+	if v.Kind() != reflect.Func || v.IsNil() {
+		return 0
+	}
+	return v.Pointer()
+}
+
+// labeledFuncName returns the label or the name of the function if there is no label.
+func labeledFuncName(label string, f interface{}) string {
+	if label != "" {
+		return label
+	}
+	return funcName(f)
+}
+
+// optionalFuncName returns the label or the name of the function, or an empty string if the function is nil.
+func optionalFuncName(label string, f interface{}) string {
+	if v := reflect.ValueOf(f); v.Kind() != reflect.Func || v.IsNil() {
+		return ""
+	}
+	return labeledFuncName(label, f)
+}
+
+var (
+	builtinFuncNamesOnce sync.Once
+	builtinFuncNames     map[uintptr]string
+)
+
+// builtinFuncName returns the name of a policy of this package.
+//
+// Closures returned by the constructor functions (e.g. Any) are named after the function by the runtime.
+// The constructors and policies that are variables are compiled to anonymous functions (init.funcN),
+// since all closures of a function literal share the code pointer, they are identified by a sample.
+func builtinFuncName(pc uintptr) (string, bool) {
+	builtinFuncNamesOnce.Do(func() {
+		funcs := map[string]interface{}{
+			"RetryOnTemporaryErrors":  RetryOnTemporaryErrors,
+			"RetryOnConnectionErrors": RetryOnConnectionErrors,
+			"NeverRetryCertErrors":    NeverRetryCertErrors,
+			"ConstantBackoff(...)":    ConstantBackoff(0, 0),
+			"LinearBackoff(...)":      LinearBackoff(0, 0, 0),
+			"ExponentialBackoff(...)": ExponentialBackoff(0, 0, 0),
+			"MultiplierBackoff(...)":  MultiplierBackoff(0, 0, 1, 0),
+			"DrainLimit(...)":         DrainLimit(0),
+			"DrainWithTimeout(...)":   DrainWithTimeout(0, time.Second),
+			"DrainInBackground(...)":  DrainInBackground(0),
+			"CloseImmediately":        CloseImmediately,
+		}
+		builtinFuncNames = make(map[uintptr]string, len(funcs))
+		for name, f := range funcs {
+			builtinFuncNames[reflect.ValueOf(f).Pointer()] = name
+		}
+	})
+
+	if name, ok := builtinFuncNames[pc]; ok {
+		return name, true
+	}
+
+	fn := runtime.FuncForPC(pc)
+	if fn == nil {
+		return "", false
+	}
+	// e.g. github.com/ybbus/httpretry.Any.func1
+	name, ok := cutPrefix(fn.Name(), reflect.TypeOf(RetryRoundtripper{}).PkgPath()+".")
+	if !ok {
+		return "", false
+	}
+	constructor := strings.SplitN(name, ".", 2)[0]
+	if constructor == "" || !unicode.IsUpper(rune(constructor[0])) {
+		return "", false
+	}
+	if constructor == name {
+		return name, true
+	}
+	return constructor + "(...)", true
+}
@@ -0,0 +1,142 @@
+package httpretry_test
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/ybbus/httpretry"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDescribe(t *testing.T) {
+	check := assert.New(t)
+
+	client := httpretry.NewDefaultClient(
+		httpretry.WithMaxRetryCount(3),
+		httpretry.WithBackoffPolicy(httpretry.ConstantBackoff(1*time.Second, 0)),
+		httpretry.WithRetryableMethods("GET"),
+		httpretry.WithAttemptTimeout(5*time.Second),
+		httpretry.WithHostOptions("slow.example.com", httpretry.WithMaxRetryCount(1)),
+	)
+	rt := client.Transport.(*httpretry.RetryRoundtripper)
+
+	t.Run("should report effective settings", func(t *testing.T) {
+		d := rt.Describe()
+
+		check.Equal("*http.Transport", d.Next)
+		check.Equal(3, d.MaxRetryCount)
+		check.Equal("DefaultRetryPolicy", d.RetryPolicy)
+		check.Equal("ConstantBackoff(...)", d.BackoffPolicy)
+		check.Equal([]string{"GET"}, d.RetryableMethods)
+		check.Equal(httpretry.Duration(5*time.Second), d.AttemptTimeout)
+		check.False(d.RateLimiter)
+		check.Equal(1, d.Hosts["slow.example.com"].MaxRetryCount)
+		check.Equal(httpretry.Duration(5*time.Second), d.Hosts["slow.example.com"].AttemptTimeout)
+	})
+
+	t.Run("should encode to json", func(t *testing.T) {
+		data, err := json.Marshal(rt.Describe())
+		check.NoError(err)
+
+		var decoded map[string]interface{}
+		check.NoError(json.Unmarshal(data, &decoded))
+		check.Equal(3.0, decoded["maxRetryCount"])
+		check.Equal("5s", decoded["attemptTimeout"])
+		check.Equal("ConstantBackoff(...)", decoded["backoffPolicy"])
+	})
+
+	t.Run("should be human readable", func(t *testing.T) {
+		s := rt.Describe().String()
+
+		check.Contains(s, "max retry count:          3\n")
+		check.Contains(s, "retry policy:             DefaultRetryPolicy\n")
+		check.Contains(s, "backoff policy:           ConstantBackoff(...)\n")
+		check.Contains(s, "host slow.example.com:\n  next:")
+	})
+}
+
+func TestDescribePolicyNames(t *testing.T) {
+	check := assert.New(t)
+
+	describe := func(opts ...httpretry.Option) httpretry.Description {
+		return httpretry.NewDefaultClient(opts...).Transport.(*httpretry.RetryRoundtripper).Describe()
+	}
+
+	t.Run("should label default policies", func(t *testing.T) {
+		d := describe()
+
+		check.Equal("DefaultRetryPolicy", d.RetryPolicy)
+		check.Equal("ExponentialBackoff(1s, 30s, 200ms)", d.BackoffPolicy)
+	})
+
+	t.Run("should name policies after their constructors", func(t *testing.T) {
+		d := describe(
+			httpretry.WithRetryPolicy(httpretry.Any(httpretry.RetryOnStatus(500), httpretry.RetryOnConnectionErrors)),
+			httpretry.WithResponseBackoffPolicy(httpretry.FromRetryAfter(nil)),
+			httpretry.WithDrainStrategy(httpretry.CloseImmediately),
+		)
+
+		check.Equal("Any(...)", d.RetryPolicy)
+		check.Equal("FromRetryAfter(...)", d.ResponseBackoffPolicy)
+		check.Equal("CloseImmediately", d.DrainStrategy)
+	})
+
+	t.Run("should use labels of the caller", func(t *testing.T) {
+		d := describe(
+			httpretry.WithRetryPolicy(func(statusCode int, err error) bool { return false }),
+			httpretry.WithPolicyLabels(httpretry.PolicyLabels{RetryPolicy: "never"}),
+		)
+
+		check.Equal("never", d.RetryPolicy)
+		check.Equal("ExponentialBackoff(1s, 30s, 200ms)", d.BackoffPolicy)
+	})
+
+	t.Run("should describe other functions by name without import path", func(t *testing.T) {
+		d := describe(httpretry.WithRetryPolicy(func(statusCode int, err error) bool { return false }))
+
+		check.True(strings.HasPrefix(d.RetryPolicy, "httpretry_test.TestDescribePolicyNames."), d.RetryPolicy)
+	})
+
+	t.Run("should drop labels of policies replaced directly", func(t *testing.T) {
+		rt := httpretry.NewDefaultClient().Transport.(*httpretry.RetryRoundtripper)
+		rt.Update(func(r *httpretry.RetryRoundtripper) {
+			r.ShouldRetry = httpretry.RetryOnStatus(http.StatusTeapot)
+			r.CalculateBackoff = httpretry.Cap(httpretry.ConstantBackoff(time.Second, 0), time.Second)
+		})
+		d := rt.Describe()
+
+		check.Equal("RetryOnStatus(...)", d.RetryPolicy)
+		check.Equal("Cap(...)", d.BackoffPolicy)
+	})
+
+	t.Run("should keep labels set directly on a struct", func(t *testing.T) {
+		rt := &httpretry.RetryRoundtripper{
+			ShouldRetry: func(statusCode int, err error) bool { return false },
+			Labels:      httpretry.PolicyLabels{RetryPolicy: "never"},
+		}
+
+		check.Equal("never", rt.Describe().RetryPolicy)
+	})
+}
+
+func TestValidate(t *testing.T) {
+	check := assert.New(t)
+
+	t.Run("default client should be valid", func(t *testing.T) {
+		rt := httpretry.NewDefaultClient().Transport.(*httpretry.RetryRoundtripper)
+		check.NoError(rt.Validate())
+	})
+
+	t.Run("should detect missing fields", func(t *testing.T) {
+		check.ErrorContains((&httpretry.RetryRoundtripper{}).Validate(), "next roundtripper")
+		check.ErrorContains((&httpretry.RetryRoundtripper{Next: http.DefaultTransport}).Validate(), "retry policy")
+		check.ErrorContains((&httpretry.RetryRoundtripper{Next: http.DefaultTransport, ShouldRetry: httpretry.DefaultRetryPolicy}).Validate(), "backoff policy")
+	})
+
+	t.Run("should validate host options", func(t *testing.T) {
+		rt := httpretry.NewDefaultClient(httpretry.WithHostOptions("a.com", httpretry.WithRetryPolicy(nil))).Transport.(*httpretry.RetryRoundtripper)
+		check.ErrorContains(rt.Validate(), "host a.com: retry policy")
+	})
+}
@@ -0,0 +1,145 @@
+package httpretry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+)
+
+// ErrWriterNotRestartable is returned by Download, if the download has to restart from zero, but the writer can not be reset.
+var ErrWriterNotRestartable = errors.New("writer cannot be restarted")
+
+// truncater is implemented by writers that can be reset to restart a download (e.g. *os.File).
+type truncater interface {
+	io.Seeker
+	Truncate(size int64) error
+}
+
+// Download streams the response of a GET request to url into w and returns the number of written bytes.
+//
+// If reading the response fails mid-transfer, the download is resumed up to MaxRetryCount times of the client's
+// retry roundtripper. If the server supports byte ranges (strong ETag and Accept-Ranges: bytes), only the remaining
+// bytes are requested with Range and If-Range. Otherwise, or if the resource changed in the meantime, the download
+// restarts from zero, which requires w to implement Seek and Truncate (like *os.File). Otherwise ErrResourceChanged
+// is returned if the resource changed, or ErrWriterNotRestartable if the server does not support ranges.
+//
+// Every single request is retried by the client as usual.
+//
+// Example:
+//   client := httpretry.NewDefaultClient()
+//   written, err := httpretry.Download(ctx, client, "https://example.com/artifact.tar.gz", file)
+func Download(ctx context.Context, client *http.Client, url string, w io.Writer) (int64, error) {
+	if client == nil {
+		panic("client must not be nil")
+	}
+
+	config := retryConfig(client)
+
+	var (
+		written int64
+		etag    string
+		ranges  bool
+	)
+	for resumes := 0; ; resumes++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return written, err
+		}
+		resumed := written > 0 && ranges
+		if resumed {
+			setRange(req, written, etag)
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return written, err
+		}
+
+		switch {
+		case resp.StatusCode == http.StatusPartialContent && resumed:
+			r, err := parseContentRange(resp.Header.Get("Content-Range"))
+			if err == nil && r.start != written {
+				err = fmt.Errorf("resumed download starts at %d instead of %d", r.start, written)
+			}
+			if err != nil {
+				config.drainBody(resp)
+				return written, err
+			}
+		case resp.StatusCode == http.StatusOK:
+			if written > 0 {
+				// the resource changed or does not support ranges, the complete resource was sent again
+				if err := truncate(w); err != nil {
+					if errors.Is(err, ErrWriterNotRestartable) && resumed && resp.Header.Get("ETag") != etag {
+						err = ErrResourceChanged
+					}
+					config.drainBody(resp)
+					return written, err
+				}
+				written = 0
+			}
+			etag, ranges = rangeValidator(resp)
+		default:
+			config.drainBody(resp)
+			return written, fmt.Errorf("unexpected status code %d while downloading %s", resp.StatusCode, url)
+		}
+
+		body := &readErrorReader{Reader: resp.Body}
+		n, err := io.Copy(w, body)
+		resp.Body.Close()
+		written += n
+
+		if err == nil {
+			return written, nil
+		}
+		if body.err == nil || resumes >= config.MaxRetryCount || ctx.Err() != nil {
+			// writing failed or no more resumes left
+			return written, err
+		}
+	}
+}
+
+// DownloadFile downloads the resource to the file at path (see Download).
+//
+// The file is created or truncated.
+func DownloadFile(ctx context.Context, client *http.Client, url string, path string) (int64, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return 0, err
+	}
+
+	written, err := Download(ctx, client, url, file)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return written, err
+}
+
+// truncate resets the writer to restart a download.
+func truncate(w io.Writer) error {
+	t, ok := w.(truncater)
+	if !ok {
+		return ErrWriterNotRestartable
+	}
+	if err := t.Truncate(0); err != nil {
+		return err
+	}
+	_, err := t.Seek(0, io.SeekStart)
+	return err
+}
+
+// readErrorReader records read errors, so they can be distinguished from write errors of io.Copy.
+type readErrorReader struct {
+	io.Reader
+	err error
+}
+
+func (r *readErrorReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	if err != nil && err != io.EOF {
+		r.err = err
+	}
+	return n, err
+}
@@ -0,0 +1,132 @@
+package httpretry
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDownload(t *testing.T) {
+	check := assert.New(t)
+
+	content := strings.Repeat("0123456789", 1000)
+
+	// newServer serves the content with the etag of the call, the first response is aborted after half of the content
+	newServer := func(etag func(called int32) string, ranges bool, rangeHeaders *[]string) *httptest.Server {
+		var calls int32
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			called := atomic.AddInt32(&calls, 1)
+			*rangeHeaders = append(*rangeHeaders, r.Header.Get("Range"))
+
+			w.Header().Set("ETag", etag(called))
+			if called == 1 {
+				if ranges {
+					w.Header().Set("Accept-Ranges", "bytes")
+				}
+				w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+				w.Write([]byte(content[:len(content)/2]))
+				w.(http.Flusher).Flush()
+				panic(http.ErrAbortHandler)
+			}
+			if !ranges {
+				w.Write([]byte(content))
+				return
+			}
+			http.ServeContent(w, r, "", time.Time{}, strings.NewReader(content))
+		}))
+	}
+	sameETag := func(called int32) string { return `"v1"` }
+	changedETag := func(called int32) string { return `"v` + strconv.Itoa(int(called)) + `"` }
+
+	client := NewDefaultClient(WithBackoffPolicy(ConstantBackoff(time.Millisecond, 0)))
+
+	t.Run("should resume with range request", func(t *testing.T) {
+		var rangeHeaders []string
+		server := newServer(sameETag, true, &rangeHeaders)
+		defer server.Close()
+
+		var buf bytes.Buffer
+		written, err := Download(context.Background(), client, server.URL, &buf)
+
+		check.NoError(err)
+		check.Equal(int64(len(content)), written)
+		check.Equal(content, buf.String())
+		check.Equal([]string{"", "bytes=" + strconv.Itoa(len(content)/2) + "-"}, rangeHeaders)
+	})
+
+	t.Run("should restart file download if resource changed", func(t *testing.T) {
+		var rangeHeaders []string
+		server := newServer(changedETag, true, &rangeHeaders)
+		defer server.Close()
+
+		path := filepath.Join(t.TempDir(), "download")
+		written, err := DownloadFile(context.Background(), client, server.URL, path)
+
+		check.NoError(err)
+		check.Equal(int64(len(content)), written)
+		data, _ := os.ReadFile(path)
+		check.Equal(content, string(data))
+		check.Len(rangeHeaders, 2)
+	})
+
+	t.Run("should restart file download without range support", func(t *testing.T) {
+		var rangeHeaders []string
+		server := newServer(sameETag, false, &rangeHeaders)
+		defer server.Close()
+
+		path := filepath.Join(t.TempDir(), "download")
+		written, err := DownloadFile(context.Background(), client, server.URL, path)
+
+		check.NoError(err)
+		check.Equal(int64(len(content)), written)
+		data, _ := os.ReadFile(path)
+		check.Equal(content, string(data))
+		check.Equal([]string{"", ""}, rangeHeaders)
+	})
+
+	t.Run("should fail if resource changed and writer can not be truncated", func(t *testing.T) {
+		var rangeHeaders []string
+		server := newServer(changedETag, true, &rangeHeaders)
+		defer server.Close()
+
+		var buf bytes.Buffer
+		written, err := Download(context.Background(), client, server.URL, &buf)
+
+		check.True(errors.Is(err, ErrResourceChanged))
+		check.Equal(int64(len(content)/2), written)
+	})
+
+	t.Run("should fail without range support if writer can not be truncated", func(t *testing.T) {
+		var rangeHeaders []string
+		server := newServer(sameETag, false, &rangeHeaders)
+		defer server.Close()
+
+		var buf bytes.Buffer
+		_, err := Download(context.Background(), client, server.URL, &buf)
+
+		check.True(errors.Is(err, ErrWriterNotRestartable))
+		check.False(errors.Is(err, ErrResourceChanged))
+	})
+
+	t.Run("should fail on unexpected status", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNotFound)
+		}))
+		defer server.Close()
+
+		var buf bytes.Buffer
+		_, err := Download(context.Background(), client, server.URL, &buf)
+
+		check.ErrorContains(err, "unexpected status code 404")
+	})
+}
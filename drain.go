@@ -0,0 +1,110 @@
+package httpretry
+
+import (
+	"io"
+	"net/http"
+	"time"
+)
+
+// DrainStrategy discards the body of a response that is not needed anymore (e.g. before a retry) and closes it.
+//
+// The http.Transport only reliably reuses a keep-alive connection if the body was read completely before it was closed,
+// otherwise the connection may be closed and the next attempt has to establish a new connection (and TLS session).
+// Draining large bodies wastes bandwidth though, so the strategy is a trade-off between both.
+// Run BenchmarkDrainStrategy to measure the connection reuse of the strategies with the used Go version.
+type DrainStrategy func(resp *http.Response)
+
+const (
+	// defaultDrainLimit is the maximum number of bytes that are discarded by the default drain strategy
+	defaultDrainLimit = 16384
+)
+
+var (
+	// defaultDrainStrategy discards up to 16 KiB of the body
+	defaultDrainStrategy = DrainLimit(defaultDrainLimit)
+
+	// DrainLimit discards up to maxBytes of the body before closing it.
+	//
+	// Bodies up to maxBytes keep the connection reusable. Whether the connection of a larger body is reused
+	// depends on the transport: the http.Transport may still reuse it if the rest of the body was already received
+	// (e.g. a 64 KiB body with a 16 KiB limit), remainders of 1 MiB and more usually close it.
+	//
+	// Example:
+	//   DrainLimit(64 << 10)
+	DrainLimit = func(maxBytes int64) DrainStrategy {
+		if maxBytes < 0 {
+			maxBytes = 0
+		}
+
+		return func(resp *http.Response) {
+			drainAndCloseBody(resp, maxBytes)
+		}
+	}
+
+	// DrainWithTimeout discards up to maxBytes of the body, but stops after timeout and closes the body,
+	// so slow servers do not delay the next attempt. A timeout <= 0 does not limit the time, like DrainLimit.
+	//
+	// The body is closed from a timer goroutine while it is still read. Bodies of the http.Transport support this,
+	// bodies returned by other roundtrippers (Next) must be safe for a Close that is concurrent to a Read.
+	//
+	// Example:
+	//   DrainWithTimeout(1 << 20, 100 * time.Millisecond)
+	DrainWithTimeout = func(maxBytes int64, timeout time.Duration) DrainStrategy {
+		if maxBytes < 0 {
+			maxBytes = 0
+		}
+		if timeout <= 0 {
+			return DrainLimit(maxBytes)
+		}
+
+		return func(resp *http.Response) {
+			// closing the body unblocks the pending read
+			timer := time.AfterFunc(timeout, func() {
+				resp.Body.Close()
+			})
+			drainAndCloseBody(resp, maxBytes)
+			timer.Stop()
+		}
+	}
+
+	// DrainInBackground discards up to maxBytes of the body in a separate goroutine,
+	// so the next attempt does not wait for it. The next attempt may not reuse the connection though,
+	// if the body was not drained yet when it starts.
+	//
+	// Example:
+	//   DrainInBackground(1 << 20)
+	DrainInBackground = func(maxBytes int64) DrainStrategy {
+		if maxBytes < 0 {
+			maxBytes = 0
+		}
+
+		return func(resp *http.Response) {
+			go drainAndCloseBody(resp, maxBytes)
+		}
+	}
+
+	// CloseImmediately closes the body without reading it. Whether the connection is reused is up to the http.Transport.
+	CloseImmediately DrainStrategy = func(resp *http.Response) {
+		resp.Body.Close()
+	}
+)
+
+// drainBody discards the response with the configured drain strategy.
+func (r *RetryRoundtripper) drainBody(resp *http.Response) {
+	if resp == nil || resp.Body == nil {
+		return
+	}
+	if r.DrainBody != nil {
+		r.DrainBody(resp)
+		return
+	}
+	defaultDrainStrategy(resp)
+}
+
+// drainAndCloseBody discards up to maxBytes of the body and closes it.
+func drainAndCloseBody(resp *http.Response, maxBytes int64) {
+	if resp != nil && resp.Body != nil {
+		io.CopyN(io.Discard, resp.Body, maxBytes)
+		resp.Body.Close()
+	}
+}
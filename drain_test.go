@@ -0,0 +1,217 @@
+package httpretry
+
+import (
+	"bytes"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// trackingBody records the read bytes and if it was closed, reads block until the body is closed if block is set.
+type trackingBody struct {
+	reader io.Reader
+	block  bool
+	read   int64
+	closed chan struct{}
+	once   sync.Once
+}
+
+func newTrackingBody(size int, block bool) *trackingBody {
+	return &trackingBody{
+		reader: strings.NewReader(strings.Repeat("x", size)),
+		block:  block,
+		closed: make(chan struct{}),
+	}
+}
+
+func (b *trackingBody) Read(p []byte) (int, error) {
+	if b.block {
+		<-b.closed
+		return 0, io.ErrClosedPipe
+	}
+	n, err := b.reader.Read(p)
+	atomic.AddInt64(&b.read, int64(n))
+	return n, err
+}
+
+func (b *trackingBody) Close() error {
+	b.once.Do(func() { close(b.closed) })
+	return nil
+}
+
+func (b *trackingBody) isClosed() bool {
+	select {
+	case <-b.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+func TestDrainStrategy(t *testing.T) {
+	check := assert.New(t)
+
+	t.Run("should drain up to limit", func(t *testing.T) {
+		body := newTrackingBody(1000, false)
+		DrainLimit(100)(&http.Response{Body: body})
+
+		check.Equal(int64(100), body.read)
+		check.True(body.isClosed())
+	})
+
+	t.Run("should stop draining after timeout", func(t *testing.T) {
+		body := newTrackingBody(1000, true)
+
+		start := time.Now()
+		DrainWithTimeout(1000, 20*time.Millisecond)(&http.Response{Body: body})
+
+		check.GreaterOrEqual(time.Since(start), 20*time.Millisecond)
+		check.True(body.isClosed())
+	})
+
+	t.Run("should not limit the time without timeout", func(t *testing.T) {
+		body := newTrackingBody(1000, false)
+		DrainWithTimeout(100, 0)(&http.Response{Body: body})
+
+		check.Equal(int64(100), body.read)
+		check.True(body.isClosed())
+	})
+
+	t.Run("should close immediately", func(t *testing.T) {
+		body := newTrackingBody(1000, false)
+		CloseImmediately(&http.Response{Body: body})
+
+		check.Equal(int64(0), body.read)
+		check.True(body.isClosed())
+	})
+
+	t.Run("should drain in background", func(t *testing.T) {
+		body := newTrackingBody(1000, false)
+		DrainInBackground(1000)(&http.Response{Body: body})
+
+		select {
+		case <-body.closed:
+		case <-time.After(time.Second):
+			check.Fail("body was not closed")
+		}
+		check.Equal(int64(1000), atomic.LoadInt64(&body.read))
+	})
+
+	t.Run("should use drain strategy before retry", func(t *testing.T) {
+		var drained []int
+		mockRoundtripper := &MockRoundtripper{}
+		mockRoundtripper.RoundTripFunc = func(req *http.Request, called int) (response *http.Response, e error) {
+			if called == 3 {
+				return FakeResponse(req, 200, []byte("ok")), nil
+			}
+			return FakeResponse(req, 500, []byte("error")), nil
+		}
+
+		retryRoundtripper := RetryRoundtripper{
+			MaxRetryCount:    3,
+			Next:             mockRoundtripper,
+			ShouldRetry:      (&MockRetryPolicy{}).ShouldRetry,
+			CalculateBackoff: (&MockBackoffPolicy{}).CalculateBackoff,
+		}
+		WithDrainStrategy(func(resp *http.Response) {
+			drained = append(drained, resp.StatusCode)
+			resp.Body.Close()
+		})(&retryRoundtripper)
+
+		req, _ := http.NewRequest("GET", "https://my-super-nonexisting-url.asd", nil)
+		_, err := retryRoundtripper.RoundTrip(req)
+
+		check.NoError(err)
+		check.Equal([]int{500, 500}, drained)
+	})
+
+	t.Run("should reuse connection if body was drained", func(t *testing.T) {
+		server := newFailingServer(32 << 10)
+		defer server.Close()
+
+		check.Equal([]bool{false, true}, connectionReuse(t, server.URL, DrainLimit(64<<10)))
+		check.Equal([]bool{false, true}, connectionReuse(t, server.URL, DrainWithTimeout(64<<10, time.Second)))
+	})
+}
+
+// newFailingServer fails every other request with 500 and an error body of the given size.
+func newFailingServer(errorBodySize int) *httptest.Server {
+	var calls int32
+	errorBody := bytes.Repeat([]byte("x"), errorBodySize)
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1)%2 == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write(errorBody)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+}
+
+// connectionReuse sends a request that is retried once and reports for every attempt if the connection was reused.
+func connectionReuse(tb testing.TB, url string, drainStrategy DrainStrategy) []bool {
+	transport := &http.Transport{}
+	defer transport.CloseIdleConnections()
+
+	var reused []bool
+	client := NewCustomClient(&http.Client{Transport: transport},
+		WithMaxRetryCount(1),
+		WithBackoffPolicy(ConstantBackoff(0, 0)),
+		WithDrainStrategy(drainStrategy),
+	)
+
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			reused = append(reused, info.Reused)
+		},
+	}
+	req, _ := http.NewRequestWithContext(httptrace.WithClientTrace(context.Background(), trace), "GET", url, nil)
+	resp, err := client.Do(req)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	return reused
+}
+
+func BenchmarkDrainStrategy(b *testing.B) {
+	strategies := []struct {
+		name     string
+		strategy DrainStrategy
+	}{
+		{name: "limit 16KiB", strategy: DrainLimit(16 << 10)},
+		{name: "limit 1MiB", strategy: DrainLimit(1 << 20)},
+		{name: "timeout 1MiB 10ms", strategy: DrainWithTimeout(1<<20, 10*time.Millisecond)},
+		{name: "background 1MiB", strategy: DrainInBackground(1 << 20)},
+		{name: "close immediately", strategy: CloseImmediately},
+	}
+
+	for _, errorBodySize := range []int{1 << 10, 64 << 10, 1 << 20, 4 << 20} {
+		server := newFailingServer(errorBodySize)
+
+		for _, s := range strategies {
+			b.Run(s.name+" body "+strconv.Itoa(errorBodySize>>10)+"KiB", func(b *testing.B) {
+				var reused int
+				for i := 0; i < b.N; i++ {
+					if connectionReuse(b, server.URL, s.strategy)[1] {
+						reused++
+					}
+				}
+				// ratio of retries that reused the connection of the failed attempt
+				b.ReportMetric(float64(reused)/float64(b.N), "reused/op")
+			})
+		}
+
+		server.Close()
+	}
+}
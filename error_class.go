@@ -0,0 +1,248 @@
+package httpretry
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ErrorClass is the result of classifying a request error with ClassifyError().
+type ErrorClass int
+
+const (
+	// ErrorClassNone means there was no error.
+	ErrorClassNone ErrorClass = iota
+	// ErrorClassUnknown is an error that could not be classified. It is considered retryable.
+	ErrorClassUnknown
+	// ErrorClassCanceled means the request context was canceled.
+	ErrorClassCanceled
+	// ErrorClassTimeout is a timeout while connecting, sending or receiving (including deadline exceeded).
+	ErrorClassTimeout
+	// ErrorClassTemporary is an error that reports itself as temporary.
+	ErrorClassTemporary
+	// ErrorClassConnection is a connection level error (e.g. connection reset, connection refused, broken pipe, unexpected EOF).
+	ErrorClassConnection
+	// ErrorClassHTTP2Stream is an error on a single http2 stream (e.g. REFUSED_STREAM).
+	ErrorClassHTTP2Stream
+	// ErrorClassDNSTemporary is a DNS lookup failure that may succeed when retrying.
+	ErrorClassDNSTemporary
+	// ErrorClassDNSNotFound means the host does not exist (NXDOMAIN).
+	ErrorClassDNSNotFound
+	// ErrorClassTLS is a TLS protocol error (e.g. the server does not speak TLS).
+	ErrorClassTLS
+	// ErrorClassCertificate is a certificate verification error (e.g. unknown authority, hostname mismatch).
+	ErrorClassCertificate
+	// ErrorClassInvalidRequest means the request itself is invalid (e.g. url parsing error, missing scheme or host).
+	ErrorClassInvalidRequest
+	// ErrorClassTooManyRedirects means the redirect limit was reached.
+	ErrorClassTooManyRedirects
+)
+
+var errorClassNames = map[ErrorClass]string{
+	ErrorClassNone:             "none",
+	ErrorClassUnknown:          "unknown",
+	ErrorClassCanceled:         "canceled",
+	ErrorClassTimeout:          "timeout",
+	ErrorClassTemporary:        "temporary",
+	ErrorClassConnection:       "connection",
+	ErrorClassHTTP2Stream:      "http2 stream",
+	ErrorClassDNSTemporary:     "dns temporary",
+	ErrorClassDNSNotFound:      "dns not found",
+	ErrorClassTLS:              "tls",
+	ErrorClassCertificate:      "certificate",
+	ErrorClassInvalidRequest:   "invalid request",
+	ErrorClassTooManyRedirects: "too many redirects",
+}
+
+// String returns a human readable name of the error class.
+func (c ErrorClass) String() string {
+	if name, ok := errorClassNames[c]; ok {
+		return name
+	}
+	return "ErrorClass(" + strconv.Itoa(int(c)) + ")"
+}
+
+// Retryable reports whether errors of this class may succeed when the request is retried.
+func (c ErrorClass) Retryable() bool {
+	switch c {
+	case
+		ErrorClassUnknown,
+		ErrorClassTimeout,
+		ErrorClassTemporary,
+		ErrorClassConnection,
+		ErrorClassHTTP2Stream,
+		ErrorClassDNSTemporary:
+		return true
+	default:
+		return false
+	}
+}
+
+// ClassifyError classifies a request error returned by a http.RoundTripper.
+//
+// Wrapped errors are unwrapped, so errors like *url.Error or *net.OpError around the actual cause are classified correctly.
+func ClassifyError(err error) ErrorClass {
+	if err == nil {
+		return ErrorClassNone
+	}
+
+	if errors.Is(err, context.Canceled) {
+		return ErrorClassCanceled
+	}
+
+	var tooManyRedirectsErr *TooManyRedirectsError
+	if errors.As(err, &tooManyRedirectsErr) {
+		return ErrorClassTooManyRedirects
+	}
+
+	var (
+		invalidRequestErr *InvalidRequestError
+		urlErr            *url.Error
+	)
+	if errors.As(err, &invalidRequestErr) || (errors.As(err, &urlErr) && urlErr.Op == "parse") {
+		return ErrorClassInvalidRequest
+	}
+
+	var (
+		unknownAuthorityErr    x509.UnknownAuthorityError
+		certificateInvalidErr  x509.CertificateInvalidError
+		hostnameErr            x509.HostnameError
+		constraintViolationErr x509.ConstraintViolationError
+	)
+	switch {
+	case
+		errors.As(err, &unknownAuthorityErr),
+		errors.As(err, &certificateInvalidErr),
+		errors.As(err, &hostnameErr),
+		errors.As(err, &constraintViolationErr):
+		return ErrorClassCertificate
+	}
+
+	var recordHeaderErr tls.RecordHeaderError
+	if errors.As(err, &recordHeaderErr) {
+		return ErrorClassTLS
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		if dnsErr.IsNotFound {
+			return ErrorClassDNSNotFound
+		}
+		// all other dns errors (timeouts, server failures etc.) may succeed when retrying
+		return ErrorClassDNSTemporary
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return ErrorClassTimeout
+	}
+	var timeoutErr interface{ Timeout() bool }
+	if errors.As(err, &timeoutErr) && timeoutErr.Timeout() {
+		return ErrorClassTimeout
+	}
+
+	switch {
+	case
+		errors.Is(err, syscall.ECONNRESET),
+		errors.Is(err, syscall.ECONNREFUSED),
+		errors.Is(err, syscall.ECONNABORTED),
+		errors.Is(err, syscall.EPIPE),
+		errors.Is(err, net.ErrClosed),
+		errors.Is(err, io.ErrUnexpectedEOF),
+		errors.Is(err, io.EOF):
+		return ErrorClassConnection
+	}
+
+	if isHTTP2StreamError(err) {
+		return ErrorClassHTTP2Stream
+	}
+
+	var temporaryErr interface{ Temporary() bool }
+	if errors.As(err, &temporaryErr) && temporaryErr.Temporary() {
+		return ErrorClassTemporary
+	}
+
+	return ErrorClassUnknown
+}
+
+// InvalidRequestError is returned without sending the request, if the request url is incomplete.
+//
+// It is classified as ErrorClassInvalidRequest.
+type InvalidRequestError struct {
+	URL    string
+	Reason string
+}
+
+func (e *InvalidRequestError) Error() string {
+	return fmt.Sprintf("invalid request url %q: %s", e.URL, e.Reason)
+}
+
+// AttemptTimeoutError is returned by an attempt that did not receive the response headers within the AttemptTimeout.
+//
+// It unwraps to context.DeadlineExceeded and is classified as ErrorClassTimeout.
+type AttemptTimeoutError struct {
+	AttemptTimeout time.Duration
+	// Err is the error of the canceled attempt, nil if the response arrived just when the timeout fired
+	Err error
+}
+
+func (e *AttemptTimeoutError) Error() string {
+	if e.Err == nil {
+		return fmt.Sprintf("attempt timeout of %s exceeded", e.AttemptTimeout)
+	}
+	return fmt.Sprintf("attempt timeout of %s exceeded: %v", e.AttemptTimeout, e.Err)
+}
+
+// Timeout reports that the error is a timeout.
+func (e *AttemptTimeoutError) Timeout() bool {
+	return true
+}
+
+// Unwrap returns context.DeadlineExceeded instead of Err, which is context.Canceled for most roundtrippers.
+func (e *AttemptTimeoutError) Unwrap() error {
+	return context.DeadlineExceeded
+}
+
+// validateRequestURL checks that the request url has a scheme and a host, which every transport requires.
+//
+// If next is an *http.Transport, the scheme must be http or https as well, since the transport rejects other schemes.
+// Protocols registered with http.Transport.RegisterProtocol are not visible here, so they are rejected, too.
+func validateRequestURL(req *http.Request, next http.RoundTripper) error {
+	switch {
+	case req.URL == nil:
+		return &InvalidRequestError{Reason: "missing url"}
+	case req.URL.Scheme == "":
+		return &InvalidRequestError{URL: req.URL.String(), Reason: "missing scheme"}
+	case req.URL.Host == "":
+		return &InvalidRequestError{URL: req.URL.String(), Reason: "missing host"}
+	}
+
+	if _, ok := next.(*http.Transport); ok && req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+		return &InvalidRequestError{URL: req.URL.String(), Reason: "unsupported protocol scheme " + req.URL.Scheme}
+	}
+	return nil
+}
+
+// isHTTP2StreamError checks for http2 stream errors.
+//
+// The http2 implementation is bundled unexported into net/http (or imported from golang.org/x/net/http2),
+// so the error can only be detected by its type name.
+func isHTTP2StreamError(err error) bool {
+	for ; err != nil; err = errors.Unwrap(err) {
+		typeName := reflect.TypeOf(err).String()
+		if strings.HasSuffix(typeName, "http2StreamError") || strings.HasSuffix(typeName, "http2.StreamError") {
+			return true
+		}
+	}
+	return false
+}
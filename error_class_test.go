@@ -0,0 +1,89 @@
+package httpretry_test
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/ybbus/httpretry"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"syscall"
+	"testing"
+)
+
+type http2StreamError struct {
+	StreamID uint32
+}
+
+func (e http2StreamError) Error() string {
+	return fmt.Sprintf("stream error: stream ID %d; REFUSED_STREAM", e.StreamID)
+}
+
+type temporaryError struct{}
+
+func (e temporaryError) Error() string   { return "temporary" }
+func (e temporaryError) Temporary() bool { return true }
+
+func TestClassifyError(t *testing.T) {
+	check := assert.New(t)
+
+	wrapURL := func(err error) error {
+		return &url.Error{Op: "Get", URL: "https://some-non-existing-url.com", Err: err}
+	}
+	wrapOp := func(err error) error {
+		return &net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", err)}
+	}
+
+	tests := []struct {
+		Description string
+		ErrorIn     error
+		Expect      httpretry.ErrorClass
+	}{
+		{"nil error", nil, httpretry.ErrorClassNone},
+		{"unknown error", errors.New("something"), httpretry.ErrorClassUnknown},
+		{"canceled", wrapURL(context.Canceled), httpretry.ErrorClassCanceled},
+		{"deadline exceeded", wrapURL(context.DeadlineExceeded), httpretry.ErrorClassTimeout},
+		{"os deadline exceeded", wrapURL(&net.OpError{Op: "read", Err: os.ErrDeadlineExceeded}), httpretry.ErrorClassTimeout},
+		{"connection reset", wrapURL(wrapOp(syscall.ECONNRESET)), httpretry.ErrorClassConnection},
+		{"connection refused", wrapURL(wrapOp(syscall.ECONNREFUSED)), httpretry.ErrorClassConnection},
+		{"broken pipe", wrapURL(wrapOp(syscall.EPIPE)), httpretry.ErrorClassConnection},
+		{"closed connection", wrapURL(fmt.Errorf("read: %w", net.ErrClosed)), httpretry.ErrorClassConnection},
+		{"unexpected EOF", wrapURL(io.ErrUnexpectedEOF), httpretry.ErrorClassConnection},
+		{"http2 stream error", wrapURL(http2StreamError{StreamID: 3}), httpretry.ErrorClassHTTP2Stream},
+		{"dns not found", wrapURL(&net.OpError{Op: "dial", Err: &net.DNSError{Err: "no such host", Name: "x", IsNotFound: true}}), httpretry.ErrorClassDNSNotFound},
+		{"dns temporary", wrapURL(&net.OpError{Op: "dial", Err: &net.DNSError{Err: "server misbehaving", Name: "x", IsTemporary: true}}), httpretry.ErrorClassDNSTemporary},
+		{"tls record header", wrapURL(tls.RecordHeaderError{Msg: "first record does not look like a TLS handshake"}), httpretry.ErrorClassTLS},
+		{"unknown authority", wrapURL(x509.UnknownAuthorityError{}), httpretry.ErrorClassCertificate},
+		{"wrapped hostname error", wrapURL(fmt.Errorf("tls: %w", x509.HostnameError{Host: "x"})), httpretry.ErrorClassCertificate},
+		{"url parse error", &url.Error{Op: "parse", URL: ":"}, httpretry.ErrorClassInvalidRequest},
+		{"invalid request url", wrapURL(&httpretry.InvalidRequestError{URL: "/path", Reason: "missing host"}), httpretry.ErrorClassInvalidRequest},
+		{"too many redirects", wrapURL(&httpretry.TooManyRedirectsError{MaxRedirects: 10, URL: "https://x"}), httpretry.ErrorClassTooManyRedirects},
+		{"temporary error", wrapURL(temporaryError{}), httpretry.ErrorClassTemporary},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Description, func(t *testing.T) {
+			check.Equal(test.Expect, httpretry.ClassifyError(test.ErrorIn), test.Expect.String())
+		})
+	}
+}
+
+func TestErrorClassRetryable(t *testing.T) {
+	check := assert.New(t)
+
+	check.True(httpretry.ErrorClassUnknown.Retryable())
+	check.True(httpretry.ErrorClassConnection.Retryable())
+	check.True(httpretry.ErrorClassDNSTemporary.Retryable())
+	check.False(httpretry.ErrorClassNone.Retryable())
+	check.False(httpretry.ErrorClassDNSNotFound.Retryable())
+	check.False(httpretry.ErrorClassCertificate.Retryable())
+	check.False(httpretry.ErrorClassInvalidRequest.Retryable())
+
+	check.Equal("connection", httpretry.ErrorClassConnection.String())
+	check.Equal("ErrorClass(100)", httpretry.ErrorClass(100).String())
+}
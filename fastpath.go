@@ -0,0 +1,40 @@
+package httpretry
+
+import (
+	"net/http"
+)
+
+// passThrough returns the next roundtripper if the request can be passed straight to it.
+//
+// This fast path is taken if no retry is possible for the request, because
+//   - MaxRetryCount is 0, or
+//   - the request context was created with DisableRetries, or
+//   - the request method is not one of the RetryableMethods, or
+//   - the request body is non-replayable: it has no GetBody and is larger than MaxBufferedBodySize or of unknown length,
+//
+// and no feature is configured that acts on single attempts, i.e. none of TokenAuth, AttemptHeader, PrepareAttempt,
+// RateLimiter, ConcurrencyLimiter, PauseGate, AttemptTimeout, FollowRedirects, a BodyReadMode other than
+// BodyReadDirect, or options registered for the request's host with WithHostOptions.
+//
+// The request is neither cloned nor its body buffered then, which makes the retry roundtripper as cheap as Next.
+// Bodies without GetBody are buffered if a retry is possible and MaxBufferedBodySize does not rule it out,
+// since they have to be replayed.
+func (r *RetryRoundtripper) passThrough(req *http.Request) (http.RoundTripper, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if r.TokenAuth != nil || r.AttemptHeader != "" || r.PrepareAttempt != nil ||
+		r.RateLimiter != nil || r.ConcurrencyLimiter != nil || r.PauseGate != nil ||
+		r.AttemptTimeout > 0 || r.FollowRedirects || r.BodyReadMode != BodyReadDirect {
+		return nil, false
+	}
+	if _, ok := r.optionsForHost(req.URL); ok {
+		return nil, false
+	}
+
+	if r.MaxRetryCount > 0 && r.isRetryableMethod(req.Method) && !retriesDisabled(req.Context()) &&
+		!r.nonReplayableBody(req) {
+		return nil, false
+	}
+	return r.Next, true
+}
@@ -1,5 +1,10 @@
 package httpretry
 
+import (
+	"net/http"
+	"time"
+)
+
 // Option is a function type to modify the RetryRoundtripper configuration
 type Option func(*RetryRoundtripper)
 
@@ -17,7 +22,7 @@ func WithMaxRetryCount(maxRetryCount int) Option {
 
 // WithRetryPolicy sets the user defined retry policy.
 //
-// Default: RetryPolicy checks for some common errors that are likely not retryable and for status codes
+// Default: DefaultRetryPolicy checks for some common errors that are likely not retryable and for status codes
 // that should be retried.
 //
 // For example:
@@ -30,6 +35,7 @@ func WithMaxRetryCount(maxRetryCount int) Option {
 func WithRetryPolicy(retryPolicy RetryPolicy) Option {
 	return func(roundtripper *RetryRoundtripper) {
 		roundtripper.ShouldRetry = retryPolicy
+		roundtripper.Labels.RetryPolicy = ""
 	}
 }
 
@@ -39,5 +45,357 @@ func WithRetryPolicy(retryPolicy RetryPolicy) Option {
 func WithBackoffPolicy(backoffPolicy BackoffPolicy) Option {
 	return func(roundtripper *RetryRoundtripper) {
 		roundtripper.CalculateBackoff = backoffPolicy
+		roundtripper.CalculateResponseBackoff = nil
+		roundtripper.Labels.BackoffPolicy = ""
+		roundtripper.Labels.ResponseBackoffPolicy = ""
+	}
+}
+
+// WithResponseBackoffPolicy sets the user defined backoff policy that also takes the last response into consideration.
+//
+// It replaces a backoff policy set by WithBackoffPolicy().
+//
+// Example:
+//   // wait as long as the server requested, or exponentially if no Retry-After header was sent
+//   WithResponseBackoffPolicy(CapResponse(FromRetryAfter(ExponentialBackoff(1*time.Second, 30*time.Second, 0)), 2*time.Minute))
+func WithResponseBackoffPolicy(backoffPolicy ResponseBackoffPolicy) Option {
+	return func(roundtripper *RetryRoundtripper) {
+		roundtripper.CalculateResponseBackoff = backoffPolicy
+		roundtripper.Labels.ResponseBackoffPolicy = ""
+	}
+}
+
+// WithBodyRetryPolicy sets a policy that decides about retries by examining the first maxBytes of the response body.
+//
+// It is only consulted if the RetryPolicy decided not to retry. The body is restored for the caller if the request is not retried.
+// RoundTrip blocks until maxBytes or the end of the body were received, so do not use it for streaming responses (e.g. SSE).
+//
+// Default: no body inspection. If maxBytes is <= 0, 4096 bytes will be examined.
+//
+// Example:
+//   WithBodyRetryPolicy(1024, RetryOnJSONField("error", "throttled"))
+func WithBodyRetryPolicy(maxBytes int64, bodyRetryPolicy BodyRetryPolicy) Option {
+	if maxBytes <= 0 {
+		maxBytes = defaultBodyPeekLimit
+	}
+	return func(roundtripper *RetryRoundtripper) {
+		roundtripper.ShouldRetryBody = bodyRetryPolicy
+		roundtripper.Labels.BodyRetryPolicy = ""
+		roundtripper.BodyPeekLimit = maxBytes
+	}
+}
+
+// WithRateLimiter sets a client side rate limiter that gates every attempt, including retries.
+//
+// The limiter tightens its rate automatically if the server responds with 429 Too Many Requests or RateLimit-Remaining headers.
+//
+// Default: no rate limiting
+//
+// Example (10 requests per second per host with bursts of up to 20 requests):
+//   WithRateLimiter(NewRateLimiter(10, 20, HostRateLimitKey, time.Minute))
+func WithRateLimiter(rateLimiter *RateLimiter) Option {
+	return func(roundtripper *RetryRoundtripper) {
+		roundtripper.RateLimiter = rateLimiter
+	}
+}
+
+// WithConcurrencyLimiter sets an adaptive limiter for the number of in-flight attempts per host.
+//
+// Excess attempts are queued or rejected with a *ConcurrencyLimitError.
+//
+// Default: no concurrency limit
+//
+// Example (between 2 and 50 in-flight attempts per host, up to 100 queued attempts, attempts slower than 2s count as overload):
+//   WithConcurrencyLimiter(NewConcurrencyLimiter(2, 50, 100, 2*time.Second))
+func WithConcurrencyLimiter(concurrencyLimiter *ConcurrencyLimiter) Option {
+	return func(roundtripper *RetryRoundtripper) {
+		roundtripper.ConcurrencyLimiter = concurrencyLimiter
+	}
+}
+
+// WithPauseGate sets a gate that pauses all attempts to a host after it responded with 503 / 429 and a Retry-After header.
+//
+// Share the same gate between clients to coordinate their pauses.
+//
+// Default: no pause gate
+//
+// Example (release waiting attempts with a jitter of up to 1s, pause for at most 2 minutes):
+//   WithPauseGate(NewPauseGate(1*time.Second, 2*time.Minute))
+func WithPauseGate(pauseGate *PauseGate) Option {
+	return func(roundtripper *RetryRoundtripper) {
+		roundtripper.PauseGate = pauseGate
+	}
+}
+
+// WithRetryableMethods restricts retries to requests with the given methods (e.g. only idempotent methods).
+//
+// Default: requests with all methods are retried
+func WithRetryableMethods(methods ...string) Option {
+	methods = append([]string(nil), methods...)
+	return func(roundtripper *RetryRoundtripper) {
+		roundtripper.RetryableMethods = methods
+	}
+}
+
+// WithAttemptTimeout limits the time of every single attempt until the response headers were received.
+//
+// An attempt that timed out fails with an *AttemptTimeoutError and is retried according to the retry policy.
+// Reading the body is not limited, so large downloads are not cut off. The request context still limits the overall time.
+//
+// Default: no timeout per attempt
+func WithAttemptTimeout(attemptTimeout time.Duration) Option {
+	if attemptTimeout < 0 {
+		attemptTimeout = 0
+	}
+	return func(roundtripper *RetryRoundtripper) {
+		roundtripper.AttemptTimeout = attemptTimeout
+	}
+}
+
+// WithMaxElapsedTime stops retrying once the time since the first attempt plus the next backoff would exceed
+// maxElapsedTime, the last response (or error) is returned then.
+// The waits for the pause gate and the rate limiter count towards the next backoff. If they are extended by other
+// requests after the last response was discarded, ErrMaxElapsedTime is returned instead.
+//
+// It is independent of the request context, so even a client with an unlimited retry count gives up eventually.
+// A maxElapsedTime of 0 disables the limit.
+//
+// Default: no limit
+//
+// Example:
+//   WithMaxRetryCount(math.MaxInt32), WithMaxElapsedTime(2*time.Minute)
+func WithMaxElapsedTime(maxElapsedTime time.Duration) Option {
+	if maxElapsedTime < 0 {
+		maxElapsedTime = 0
+	}
+	return func(roundtripper *RetryRoundtripper) {
+		roundtripper.MaxElapsedTime = maxElapsedTime
+	}
+}
+
+// WithMaxBufferedBodySize limits the size of request bodies without GetBody (e.g. streams) that are buffered
+// in memory to be replayed on a retry.
+//
+// Larger bodies and bodies of unknown length are non-replayable: the request is sent exactly once without
+// buffering, and passed straight to the next roundtripper if no feature acts on single attempts.
+// Bodies with GetBody are never buffered and not affected. A maxBytes of 0 buffers all bodies.
+//
+// Default: no limit
+//
+// Example:
+//   WithMaxBufferedBodySize(1 << 20)
+func WithMaxBufferedBodySize(maxBytes int64) Option {
+	if maxBytes < 0 {
+		maxBytes = 0
+	}
+	return func(roundtripper *RetryRoundtripper) {
+		roundtripper.MaxBufferedBodySize = maxBytes
+	}
+}
+
+// WithHostOptions applies the options on top of the client configuration for requests to the given host.
+//
+// The host may contain a port (e.g. "api.example.com:8443"), options for the host including the port take precedence.
+//
+// Example:
+//   WithHostOptions("slow.example.com", WithMaxRetryCount(10), WithAttemptTimeout(30*time.Second))
+func WithHostOptions(host string, opts ...Option) Option {
+	opts = append([]Option(nil), opts...)
+	return func(roundtripper *RetryRoundtripper) {
+		// copy on write, since the map may be shared with copies of the configuration
+		hostOptions := make(map[string][]Option, len(roundtripper.hostOptions)+1)
+		for h, o := range roundtripper.hostOptions {
+			hostOptions[h] = o
+		}
+		hostOptions[host] = append(append([]Option(nil), hostOptions[host]...), opts...)
+		roundtripper.hostOptions = hostOptions
+	}
+}
+
+// WithAttemptMiddleware inserts the middlewares between the retry roundtripper and the original roundtripper,
+// so they are executed for every attempt. The first middleware is the outermost.
+//
+// Example:
+//   WithAttemptMiddleware(loggingMiddleware, metricsMiddleware)
+func WithAttemptMiddleware(middlewares ...Middleware) Option {
+	middlewares = append([]Middleware(nil), middlewares...)
+	return func(roundtripper *RetryRoundtripper) {
+		next := roundtripper.Next
+		if next == nil {
+			next = http.DefaultTransport
+		}
+		roundtripper.Next = chain(next, middlewares)
+	}
+}
+
+// WithPrepareAttempt sets a hook that is called before every attempt with a fresh clone of the original request.
+//
+// The hook may modify the clone (e.g. refresh an auth token, re-sign the request) or reject the attempt by returning an error.
+//
+// Example:
+//   WithPrepareAttempt(func(req *http.Request, attemptCount int) error {
+//     req.Header.Set("Date", time.Now().UTC().Format(http.TimeFormat))
+//     return nil
+//   })
+func WithPrepareAttempt(prepareAttempt PrepareAttemptFunc) Option {
+	return func(roundtripper *RetryRoundtripper) {
+		roundtripper.PrepareAttempt = prepareAttempt
+		roundtripper.Labels.PrepareAttempt = ""
+	}
+}
+
+// WithAttemptHeader sets a header with the attempt number on every attempt, so servers and load balancers can distinguish
+// first attempts from retries. The header is only set on the attempt, never on the caller's request.
+//
+// If header is empty, DefaultAttemptHeader is used. If format is nil, FormatRetryCount is used.
+//
+// Default: no attempt header
+//
+// Example:
+//   WithAttemptHeader("Retry-Attempt", httpretry.FormatAttemptWithTimestamp)
+func WithAttemptHeader(header string, format AttemptHeaderFormatter) Option {
+	if header == "" {
+		header = DefaultAttemptHeader
+	}
+	if format == nil {
+		format = FormatRetryCount
+	}
+	return func(roundtripper *RetryRoundtripper) {
+		roundtripper.AttemptHeader = header
+		roundtripper.FormatAttemptHeader = format
+	}
+}
+
+// WithTokenAuth authorizes every attempt with a bearer token of the token auth.
+//
+// If the server responds with 401 Unauthorized, the token is refreshed and the request is replayed exactly once,
+// independent of the retry policy.
+//
+// Default: no token auth
+//
+// Example:
+//   WithTokenAuth(httpretry.NewTokenAuth(fetchToken, true))
+func WithTokenAuth(tokenAuth *TokenAuth) Option {
+	return func(roundtripper *RetryRoundtripper) {
+		roundtripper.TokenAuth = tokenAuth
+	}
+}
+
+// WithRedirects lets the retry roundtripper follow redirects instead of the http.Client,
+// so the whole redirect chain is retried as one attempt.
+//
+// At most maxRedirects redirects are followed, otherwise a *TooManyRedirectsError is returned.
+// If maxRedirects <= 0, DefaultMaxRedirects is used.
+// The policy may stop following redirects (optional, see RedirectPolicy).
+// Credentials (e.g. Authorization, Cookie) are removed if a redirect points to a different host.
+// 307 and 308 redirects are followed with the replayed request body.
+//
+// The intermediate redirect responses do not pass the http.Client, so its Jar does not receive their
+// Set-Cookie headers and does not add cookies to the redirected requests. Only the final response reaches the Jar.
+//
+// NewDefaultClient() and NewCustomClient() disable the redirects of the http.Client if it has no CheckRedirect set.
+//
+// Default: redirects are followed by the http.Client
+//
+// Example:
+//   WithRedirects(httpretry.DefaultMaxRedirects, nil)
+func WithRedirects(maxRedirects int, policy RedirectPolicy) Option {
+	if maxRedirects <= 0 {
+		maxRedirects = DefaultMaxRedirects
+	}
+	return func(roundtripper *RetryRoundtripper) {
+		roundtripper.FollowRedirects = true
+		roundtripper.MaxRedirects = maxRedirects
+		roundtripper.CheckRedirect = policy
+		roundtripper.Labels.RedirectPolicy = ""
+	}
+}
+
+// WithBufferedBody reads the first maxBytes of the response body before the response is returned,
+// so failures while reading the body (e.g. connection reset) are retried like other errors.
+//
+// Larger bodies are streamed after the buffered bytes. If maxBytes <= 0, 1 MiB is buffered.
+//
+// Default: the body is not buffered, read failures are returned to the caller
+//
+// Example:
+//   WithBufferedBody(10 << 20)
+func WithBufferedBody(maxBytes int64) Option {
+	if maxBytes <= 0 {
+		maxBytes = defaultBodyBufferLimit
+	}
+	return func(roundtripper *RetryRoundtripper) {
+		roundtripper.BodyReadMode = BodyReadBuffered
+		roundtripper.BodyBufferLimit = maxBytes
+	}
+}
+
+// WithResumableBody returns response bodies of GET requests that re-issue the request if reading fails,
+// up to MaxRetryCount times per body.
+//
+// If the server supports byte ranges (strong ETag and Accept-Ranges: bytes), only the remaining bytes are requested
+// with Range and If-Range. Otherwise, the already delivered bytes are skipped. ErrResourceChanged is returned
+// if the resource changed in the meantime.
+//
+// Bodies are only resumed if the resource has a strong ETag, or Last-Modified and Content-Length headers,
+// since a change could not be detected otherwise. Read failures of other bodies are returned to the caller.
+//
+// Default: read failures are returned to the caller
+func WithResumableBody() Option {
+	return func(roundtripper *RetryRoundtripper) {
+		roundtripper.BodyReadMode = BodyReadResumable
+	}
+}
+
+// WithDrainStrategy sets the strategy that discards responses that are not needed anymore (e.g. before a retry).
+//
+// Default: DrainLimit(16384)
+//
+// Example:
+//   // keep connections reusable for error bodies up to 1 MiB, but do not wait longer than 100ms
+//   WithDrainStrategy(DrainWithTimeout(1 << 20, 100 * time.Millisecond))
+func WithDrainStrategy(drainStrategy DrainStrategy) Option {
+	return func(roundtripper *RetryRoundtripper) {
+		roundtripper.DrainBody = drainStrategy
+		roundtripper.Labels.DrainStrategy = ""
+	}
+}
+
+// WithFailedAttemptCapture captures a snapshot (status, headers and the first maxBodyBytes of the body) of every
+// failed attempt before it is discarded. Credentials (Authorization, Proxy-Authorization, Cookie, Set-Cookie) are redacted.
+//
+// The snapshots are passed to onFailedAttempt (optional) and are accessible from the final error of the request
+// as *FailedAttemptsError. If maxBodyBytes <= 0, 1024 bytes are captured.
+//
+// Default: failed attempts are not captured
+//
+// Example:
+//   WithFailedAttemptCapture(4096, func(snapshot AttemptSnapshot) {
+//     log.Printf("attempt %d failed with %d: %s", snapshot.AttemptCount, snapshot.StatusCode, snapshot.Body)
+//   })
+func WithFailedAttemptCapture(maxBodyBytes int64, onFailedAttempt FailedAttemptFunc) Option {
+	if maxBodyBytes <= 0 {
+		maxBodyBytes = defaultFailedAttemptBodyLimit
+	}
+	return func(roundtripper *RetryRoundtripper) {
+		roundtripper.CaptureFailedAttempts = true
+		roundtripper.FailedAttemptBodyLimit = maxBodyBytes
+		roundtripper.OnFailedAttempt = onFailedAttempt
+	}
+}
+
+// WithPolicyLabels sets the labels that Describe() reports instead of the function names of the policies.
+//
+// Only the non-empty labels are set. Options that replace a policy remove its label, so apply the labels afterwards.
+// A label is also dropped if its policy is replaced directly (e.g. with Update), as long as the replacement
+// is a function of another constructor.
+//
+// Default: the default retry and backoff policies are labeled, all other policies are described by their function names
+//
+// Example:
+//   WithRetryPolicy(myRetryPolicy), WithPolicyLabels(PolicyLabels{RetryPolicy: "retry 5xx except 501"})
+func WithPolicyLabels(labels PolicyLabels) Option {
+	return func(roundtripper *RetryRoundtripper) {
+		roundtripper.setLabels(labels)
 	}
 }
@@ -0,0 +1,119 @@
+package httpretry
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// PauseGate coordinates server requested pauses between all requests to the same host.
+//
+// If a host responds with 503 Service Unavailable or 429 Too Many Requests and a Retry-After header,
+// the pause is recorded once and all in-flight and new attempts to that host wait until it lifts.
+// Waiting attempts are released with a random jitter, so they do not hit the host in a synchronized burst.
+//
+// A PauseGate is safe for concurrent use and may be shared between multiple clients.
+type PauseGate struct {
+	maxJitter time.Duration
+	maxPause  time.Duration
+
+	mu          sync.Mutex
+	pausedUntil map[string]time.Time
+}
+
+// defaultMaxPause is the longest pause a single response may request if no maxPause is given
+const defaultMaxPause = 5 * time.Minute
+
+// NewPauseGate returns a pause gate that releases waiting attempts with a random jitter in [0, maxJitter).
+//
+// maxPause caps the pause a single response may request, so a bogus Retry-After header can not block
+// all requests to a host indefinitely. If maxPause is <= 0, 5 minutes are used.
+func NewPauseGate(maxJitter time.Duration, maxPause time.Duration) *PauseGate {
+	if maxJitter < 0 {
+		maxJitter = 0
+	}
+	if maxPause <= 0 {
+		maxPause = defaultMaxPause
+	}
+	return &PauseGate{
+		maxJitter:   maxJitter,
+		maxPause:    maxPause,
+		pausedUntil: make(map[string]time.Time),
+	}
+}
+
+// Wait blocks until the pause of the request's host lifted or the request context is done.
+func (g *PauseGate) Wait(req *http.Request) error {
+	return g.wait(req, time.Time{})
+}
+
+// wait blocks like Wait, but returns errWaitDeadline without waiting if the pause lifts after the deadline (if not zero).
+func (g *PauseGate) wait(req *http.Request, deadline time.Time) error {
+	host := req.URL.Host
+	jitter := randJitter(g.maxJitter)
+
+	for {
+		wait := g.remainingPause(host)
+		if wait <= 0 {
+			return nil
+		}
+		if !deadline.IsZero() && wait > time.Until(deadline) {
+			return errWaitDeadline
+		}
+
+		timer := time.NewTimer(wait + jitter)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return req.Context().Err()
+		case <-timer.C:
+			// the pause may have been extended in the meantime, so check again
+		}
+	}
+}
+
+// Observe records the pause requested by the response.
+func (g *PauseGate) Observe(req *http.Request, resp *http.Response) {
+	if resp == nil {
+		return
+	}
+	switch resp.StatusCode {
+	case http.StatusServiceUnavailable, http.StatusTooManyRequests:
+	default:
+		return
+	}
+
+	wait, ok := retryAfter(resp)
+	if !ok || wait <= 0 {
+		return
+	}
+	if wait > g.maxPause {
+		wait = g.maxPause
+	}
+
+	until := time.Now().Add(wait)
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if until.After(g.pausedUntil[req.URL.Host]) {
+		g.pausedUntil[req.URL.Host] = until
+	}
+}
+
+// remainingPause returns the remaining pause of the host and forgets lifted pauses.
+func (g *PauseGate) remainingPause(host string) time.Duration {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	until, ok := g.pausedUntil[host]
+	if !ok {
+		return 0
+	}
+
+	wait := time.Until(until)
+	if wait <= 0 {
+		delete(g.pausedUntil, host)
+	}
+	return wait
+}
@@ -0,0 +1,140 @@
+package httpretry
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPauseGate(t *testing.T) {
+	check := assert.New(t)
+
+	newResponse := func(req *http.Request, statusCode int, retryAfter string) *http.Response {
+		resp := FakeResponse(req, statusCode, nil)
+		resp.Header = http.Header{"Retry-After": []string{retryAfter}}
+		return resp
+	}
+
+	t.Run("should not wait without pause", func(t *testing.T) {
+		gate := NewPauseGate(0, 0)
+		req, _ := http.NewRequest("GET", "https://host-a.asd", nil)
+
+		start := time.Now()
+		check.NoError(gate.Wait(req))
+		check.Less(time.Since(start), 10*time.Millisecond)
+	})
+
+	t.Run("should only record pauses of 503 and 429", func(t *testing.T) {
+		gate := NewPauseGate(0, 0)
+		req, _ := http.NewRequest("GET", "https://host-a.asd", nil)
+
+		gate.Observe(req, newResponse(req, http.StatusInternalServerError, "10"))
+		gate.Observe(req, nil)
+		check.Empty(gate.pausedUntil)
+
+		gate.Observe(req, newResponse(req, http.StatusServiceUnavailable, "10"))
+		check.Len(gate.pausedUntil, 1)
+	})
+
+	t.Run("should only extend pauses", func(t *testing.T) {
+		gate := NewPauseGate(0, 0)
+		req, _ := http.NewRequest("GET", "https://host-a.asd", nil)
+
+		gate.Observe(req, newResponse(req, http.StatusTooManyRequests, "10"))
+		gate.Observe(req, newResponse(req, http.StatusTooManyRequests, "1"))
+
+		check.WithinDuration(time.Now().Add(10*time.Second), gate.pausedUntil["host-a.asd"], 100*time.Millisecond)
+	})
+
+	t.Run("should cap huge pauses", func(t *testing.T) {
+		gate := NewPauseGate(0, 2*time.Second)
+		req, _ := http.NewRequest("GET", "https://host-a.asd", nil)
+
+		gate.Observe(req, newResponse(req, http.StatusServiceUnavailable, "99999999"))
+		check.WithinDuration(time.Now().Add(2*time.Second), gate.pausedUntil["host-a.asd"], 100*time.Millisecond)
+
+		defaultGate := NewPauseGate(0, 0)
+		defaultGate.Observe(req, newResponse(req, http.StatusServiceUnavailable, "99999999"))
+		check.WithinDuration(time.Now().Add(defaultMaxPause), defaultGate.pausedUntil["host-a.asd"], 100*time.Millisecond)
+	})
+
+	t.Run("should pause all requests to host", func(t *testing.T) {
+		gate := NewPauseGate(10*time.Millisecond, 0)
+		req, _ := http.NewRequest("GET", "https://host-a.asd", nil)
+		otherHost, _ := http.NewRequest("GET", "https://host-b.asd", nil)
+
+		gate.pausedUntil["host-a.asd"] = time.Now().Add(30 * time.Millisecond)
+
+		start := time.Now()
+		check.NoError(gate.Wait(otherHost))
+		check.Less(time.Since(start), 10*time.Millisecond)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 5; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				check.NoError(gate.Wait(req))
+				check.GreaterOrEqual(time.Since(start), 30*time.Millisecond)
+			}()
+		}
+		wg.Wait()
+
+		check.Empty(gate.pausedUntil)
+	})
+
+	t.Run("should not wait beyond deadline", func(t *testing.T) {
+		gate := NewPauseGate(0, 0)
+		req, _ := http.NewRequest("GET", "https://host-a.asd", nil)
+		gate.pausedUntil["host-a.asd"] = time.Now().Add(10 * time.Second)
+
+		start := time.Now()
+		check.ErrorIs(gate.wait(req, time.Now().Add(time.Second)), errWaitDeadline)
+		check.Less(time.Since(start), 10*time.Millisecond)
+	})
+
+	t.Run("should return context error while paused", func(t *testing.T) {
+		gate := NewPauseGate(0, 0)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		req, _ := http.NewRequestWithContext(ctx, "GET", "https://host-a.asd", nil)
+
+		gate.pausedUntil["host-a.asd"] = time.Now().Add(10 * time.Second)
+
+		check.ErrorIs(gate.Wait(req), context.DeadlineExceeded)
+	})
+}
+
+func TestRetryRoundtripperPauseGate(t *testing.T) {
+	check := assert.New(t)
+
+	var calls int32
+	retryRoundtripper := &RetryRoundtripper{
+		MaxRetryCount:    1,
+		ShouldRetry:      DefaultRetryPolicy,
+		CalculateBackoff: ConstantBackoff(0, 0),
+		PauseGate:        NewPauseGate(0, 0),
+		Next: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			if atomic.AddInt32(&calls, 1) == 1 {
+				resp := FakeResponse(req, http.StatusServiceUnavailable, []byte("busy"))
+				resp.Header = http.Header{"Retry-After": []string{"1"}}
+				return resp, nil
+			}
+			return FakeResponse(req, 200, []byte("ok")), nil
+		}),
+	}
+
+	t.Run("should wait for requested pause before retrying", func(t *testing.T) {
+		start := time.Now()
+		req, _ := http.NewRequest("GET", "https://my-super-nonexisting-url.asd", nil)
+		res, err := retryRoundtripper.RoundTrip(req)
+
+		check.NoError(err)
+		check.Equal(200, res.StatusCode)
+		check.GreaterOrEqual(time.Since(start), 1*time.Second)
+	})
+}
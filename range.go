@@ -0,0 +1,110 @@
+package httpretry
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// contentRange is the parsed Content-Range header of a 206 Partial Content response.
+type contentRange struct {
+	start int64
+	end   int64
+	// size is -1 if the complete length is unknown
+	size int64
+}
+
+// parseContentRange parses a Content-Range header like "bytes 100-199/1000" or "bytes 100-199/*".
+func parseContentRange(value string) (contentRange, error) {
+	invalid := fmt.Errorf("invalid Content-Range header %q", value)
+
+	rangeSpec, ok := cutPrefix(value, "bytes ")
+	if !ok {
+		return contentRange{}, invalid
+	}
+	slash := strings.IndexByte(rangeSpec, '/')
+	if slash < 0 {
+		return contentRange{}, invalid
+	}
+	positions, size := rangeSpec[:slash], rangeSpec[slash+1:]
+	dash := strings.IndexByte(positions, '-')
+	if dash < 0 {
+		return contentRange{}, invalid
+	}
+
+	var (
+		r   = contentRange{size: -1}
+		err error
+	)
+	if r.start, err = strconv.ParseInt(positions[:dash], 10, 64); err != nil || r.start < 0 {
+		return contentRange{}, invalid
+	}
+	if r.end, err = strconv.ParseInt(positions[dash+1:], 10, 64); err != nil || r.end < r.start {
+		return contentRange{}, invalid
+	}
+	if size != "*" {
+		if r.size, err = strconv.ParseInt(size, 10, 64); err != nil || r.size <= r.end {
+			return contentRange{}, invalid
+		}
+	}
+	return r, nil
+}
+
+// rangeValidator returns the strong ETag of the response, if the server supports byte range requests for the resource.
+//
+// Weak ETags must not be used with If-Range, and compressed responses can not be resumed,
+// since the offset refers to the decompressed body.
+func rangeValidator(resp *http.Response) (string, bool) {
+	if resp.Uncompressed || !strings.EqualFold(resp.Header.Get("Accept-Ranges"), "bytes") {
+		return "", false
+	}
+	etag := resp.Header.Get("ETag")
+	if etag == "" || strings.HasPrefix(etag, "W/") {
+		return "", false
+	}
+	return etag, true
+}
+
+// resourceVersion identifies the version of a resource, to detect changes while resuming a body.
+type resourceVersion struct {
+	etag          string
+	lastModified  string
+	contentLength int64
+}
+
+// newResourceVersion returns the version of the resource of the response.
+//
+// ok is false if the response has no reliable validator, which is either a strong ETag,
+// or a Last-Modified header together with the Content-Length.
+func newResourceVersion(resp *http.Response) (v resourceVersion, ok bool) {
+	if etag := resp.Header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		return resourceVersion{etag: etag}, true
+	}
+	if lastModified := resp.Header.Get("Last-Modified"); lastModified != "" && resp.ContentLength >= 0 {
+		return resourceVersion{lastModified: lastModified, contentLength: resp.ContentLength}, true
+	}
+	return resourceVersion{}, false
+}
+
+// matches checks if the response has the same version of the resource.
+func (v resourceVersion) matches(resp *http.Response) bool {
+	if v.etag != "" {
+		return resp.Header.Get("ETag") == v.etag
+	}
+	return resp.Header.Get("Last-Modified") == v.lastModified && resp.ContentLength == v.contentLength
+}
+
+// setRange requests the resource from offset on, if it still matches the etag.
+func setRange(req *http.Request, offset int64, etag string) {
+	req.Header.Set("Range", "bytes="+strconv.FormatInt(offset, 10)+"-")
+	req.Header.Set("If-Range", etag)
+}
+
+// cutPrefix works like strings.CutPrefix, which requires go 1.20.
+func cutPrefix(s, prefix string) (string, bool) {
+	if !strings.HasPrefix(s, prefix) {
+		return s, false
+	}
+	return s[len(prefix):], true
+}
@@ -0,0 +1,62 @@
+package httpretry
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+)
+
+func TestParseContentRange(t *testing.T) {
+	check := assert.New(t)
+
+	tests := []struct {
+		value   string
+		want    contentRange
+		wantErr bool
+	}{
+		{value: "bytes 0-99/1000", want: contentRange{start: 0, end: 99, size: 1000}},
+		{value: "bytes 100-199/*", want: contentRange{start: 100, end: 199, size: -1}},
+		{value: "bytes */1000", wantErr: true},
+		{value: "bytes 100-99/1000", wantErr: true},
+		{value: "bytes 0-999/1000", want: contentRange{start: 0, end: 999, size: 1000}},
+		{value: "bytes 0-1000/1000", wantErr: true},
+		{value: "items 0-99/1000", wantErr: true},
+		{value: "", wantErr: true},
+	}
+
+	for _, test := range tests {
+		got, err := parseContentRange(test.value)
+		if test.wantErr {
+			check.Error(err, test.value)
+			continue
+		}
+		check.NoError(err, test.value)
+		check.Equal(test.want, got, test.value)
+	}
+}
+
+func TestRangeValidator(t *testing.T) {
+	check := assert.New(t)
+
+	newResponse := func(header http.Header) *http.Response {
+		return &http.Response{Header: header}
+	}
+
+	etag, ok := rangeValidator(newResponse(http.Header{"Etag": {`"v1"`}, "Accept-Ranges": {"bytes"}}))
+	check.True(ok)
+	check.Equal(`"v1"`, etag)
+
+	_, ok = rangeValidator(newResponse(http.Header{"Etag": {`W/"v1"`}, "Accept-Ranges": {"bytes"}}))
+	check.False(ok, "weak etags can not be used with If-Range")
+
+	_, ok = rangeValidator(newResponse(http.Header{"Etag": {`"v1"`}}))
+	check.False(ok)
+
+	_, ok = rangeValidator(newResponse(http.Header{"Accept-Ranges": {"bytes"}}))
+	check.False(ok)
+
+	resp := newResponse(http.Header{"Etag": {`"v1"`}, "Accept-Ranges": {"bytes"}})
+	resp.Uncompressed = true
+	_, ok = rangeValidator(resp)
+	check.False(ok, "compressed responses can not be resumed")
+}
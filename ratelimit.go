@@ -0,0 +1,309 @@
+package httpretry
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// rateLimitDecreaseFactor is applied to the current rate when a 429 Too Many Requests is observed
+	rateLimitDecreaseFactor = 0.5
+	// rateLimitRecoveryFraction of the configured rate is added back on every successful response
+	rateLimitRecoveryFraction = 0.05
+	// rateLimitMinFraction of the configured rate is the lowest rate the limiter will tighten to
+	rateLimitMinFraction = 0.01
+	// unixTimestampThreshold distinguishes unix timestamps from delta seconds in reset headers
+	unixTimestampThreshold = 1000000000
+	// defaultMaxRateLimitBlock is the longest time a bucket is blocked by a response if no maxBlock is given
+	defaultMaxRateLimitBlock = 5 * time.Minute
+	// bucketIdleTimeout is the time after which idle, fully refilled buckets are forgotten
+	bucketIdleTimeout = time.Minute
+)
+
+// RateLimitKeyFunc returns the key of the bucket a request is counted against.
+type RateLimitKeyFunc func(req *http.Request) string
+
+var (
+	// GlobalRateLimitKey counts all requests against the same bucket.
+	GlobalRateLimitKey RateLimitKeyFunc = func(req *http.Request) string {
+		return ""
+	}
+
+	// HostRateLimitKey counts requests against one bucket per host (including the port).
+	HostRateLimitKey RateLimitKeyFunc = func(req *http.Request) string {
+		return req.URL.Host
+	}
+)
+
+// RateLimiter is a client side token bucket rate limiter that gates every attempt of the retry roundtripper, including retries.
+//
+// The rate automatically tightens if the server responds with 429 Too Many Requests or reports an exhausted quota
+// with the RateLimit-Remaining / X-RateLimit-Remaining headers, and slowly recovers on successful responses.
+//
+// A RateLimiter is safe for concurrent use and may be shared between multiple clients.
+type RateLimiter struct {
+	rate     float64
+	burst    float64
+	keyFunc  RateLimitKeyFunc
+	maxBlock time.Duration
+
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+// tokenBucket holds the state of a single rate limit key.
+type tokenBucket struct {
+	rate         float64 // current tokens per second, may be lower than the configured rate
+	tokens       float64 // available tokens, negative if attempts are waiting for reserved tokens
+	last         time.Time
+	blockedUntil time.Time
+}
+
+// NewRateLimiter returns a rate limiter that allows requestsPerSecond attempts with bursts of up to burst attempts.
+//
+// keyFunc decides which bucket a request is counted against (e.g. GlobalRateLimitKey or HostRateLimitKey).
+// If keyFunc is nil, GlobalRateLimitKey is used.
+//
+// maxBlock caps how long a single response may block a bucket with an exhausted quota or a Retry-After header,
+// so a bogus header can not block all requests indefinitely. If maxBlock is <= 0, 5 minutes are used.
+//
+// Buckets that were idle for a minute and are fully refilled are forgotten, so keys of a RateLimitKeyFunc
+// with many distinct values do not accumulate.
+func NewRateLimiter(requestsPerSecond float64, burst int, keyFunc RateLimitKeyFunc, maxBlock time.Duration) *RateLimiter {
+	if requestsPerSecond <= 0 {
+		panic("requestsPerSecond must be > 0")
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	if keyFunc == nil {
+		keyFunc = GlobalRateLimitKey
+	}
+	if maxBlock <= 0 {
+		maxBlock = defaultMaxRateLimitBlock
+	}
+
+	return &RateLimiter{
+		rate:      requestsPerSecond,
+		burst:     float64(burst),
+		keyFunc:   keyFunc,
+		maxBlock:  maxBlock,
+		buckets:   make(map[string]*tokenBucket),
+		lastSweep: time.Now(),
+	}
+}
+
+// Wait blocks until the request is allowed to be sent or the request context is done.
+func (l *RateLimiter) Wait(req *http.Request) error {
+	return l.wait(req, time.Time{})
+}
+
+// wait blocks like Wait, but returns errWaitDeadline without taking a token if the request would be allowed
+// after the deadline (if not zero).
+func (l *RateLimiter) wait(req *http.Request, deadline time.Time) error {
+	key := l.keyFunc(req)
+
+	l.mu.Lock()
+	now := time.Now()
+	b := l.bucket(key, now)
+	b.refill(now, l.burst)
+	b.tokens--
+	wait := b.blockedUntil.Sub(now)
+	if tokenWait := time.Duration(-b.tokens / b.rate * float64(time.Second)); tokenWait > wait {
+		wait = tokenWait
+	}
+	if !deadline.IsZero() && wait > deadline.Sub(now) {
+		b.tokens++
+		l.mu.Unlock()
+		return errWaitDeadline
+	}
+	l.mu.Unlock()
+
+	if wait <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-req.Context().Done():
+		// give back the reserved token
+		l.mu.Lock()
+		b.tokens++
+		l.mu.Unlock()
+		return req.Context().Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// Observe adjusts the rate of the request's bucket according to the response.
+func (l *RateLimiter) Observe(req *http.Request, resp *http.Response) {
+	if resp == nil {
+		return
+	}
+
+	key := l.keyFunc(req)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	b := l.bucket(key, now)
+	b.refill(now, l.burst)
+
+	// the quota can only be applied if the server reports when it is reset
+	var quotaApplied bool
+	if remaining, ok := rateLimitHeader(resp.Header, "Remaining"); ok {
+		if reset, ok := rateLimitReset(resp.Header, now); ok {
+			if remaining == 0 {
+				b.blockUntil(minTime(reset, now.Add(l.maxBlock)))
+				quotaApplied = true
+			} else if untilReset := reset.Sub(now).Seconds(); untilReset > 0 {
+				// spread the remaining quota over the time until the quota is reset
+				b.rate = minFloat(maxFloat(float64(remaining)/untilReset, l.rate*rateLimitMinFraction), l.rate)
+				quotaApplied = true
+			}
+		}
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+		b.rate = maxFloat(b.rate*rateLimitDecreaseFactor, l.rate*rateLimitMinFraction)
+		if wait, ok := retryAfter(resp); ok {
+			if wait > l.maxBlock {
+				wait = l.maxBlock
+			}
+			b.blockUntil(now.Add(wait))
+		}
+	case resp.StatusCode < 400 && !quotaApplied:
+		// the server did not report a usable quota, so slowly recover to the configured rate
+		b.rate = minFloat(b.rate+l.rate*rateLimitRecoveryFraction, l.rate)
+	}
+}
+
+// delay returns how long a request that is sent at the given time would wait, without taking a token.
+func (l *RateLimiter) delay(req *http.Request, at time.Time) time.Duration {
+	key := l.keyFunc(req)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b := l.bucket(key, time.Now())
+	tokens := b.tokens
+	if elapsed := at.Sub(b.last).Seconds(); elapsed > 0 {
+		tokens = minFloat(tokens+elapsed*b.rate, l.burst)
+	}
+	wait := b.blockedUntil.Sub(at)
+	if tokenWait := time.Duration((1 - tokens) / b.rate * float64(time.Second)); tokens < 1 && tokenWait > wait {
+		wait = tokenWait
+	}
+	return wait
+}
+
+// bucket returns the bucket for the given key, l.mu must be held.
+func (l *RateLimiter) bucket(key string, now time.Time) *tokenBucket {
+	if now.Sub(l.lastSweep) > bucketIdleTimeout {
+		l.sweep(now)
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &tokenBucket{
+			rate:   l.rate,
+			tokens: l.burst,
+			last:   now,
+		}
+		l.buckets[key] = b
+	}
+	return b
+}
+
+// sweep forgets idle buckets that are fully refilled and not blocked, l.mu must be held.
+//
+// Such a bucket behaves exactly like a new one, apart from a tightened rate that is outdated by now.
+func (l *RateLimiter) sweep(now time.Time) {
+	l.lastSweep = now
+	for key, b := range l.buckets {
+		if now.Sub(b.last) <= bucketIdleTimeout || now.Before(b.blockedUntil) {
+			continue
+		}
+		if b.tokens+now.Sub(b.last).Seconds()*b.rate >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// refill adds the tokens that were generated since the last refill.
+func (b *tokenBucket) refill(now time.Time, burst float64) {
+	elapsed := now.Sub(b.last).Seconds()
+	if elapsed > 0 {
+		b.tokens = minFloat(b.tokens+elapsed*b.rate, burst)
+		b.last = now
+	}
+}
+
+// blockUntil blocks all attempts until the given time.
+func (b *tokenBucket) blockUntil(until time.Time) {
+	if until.After(b.blockedUntil) {
+		b.blockedUntil = until
+	}
+}
+
+// rateLimitHeader returns the value of the RateLimit-<name> or X-RateLimit-<name> header.
+//
+// Only the first value of a comma separated list is considered.
+func rateLimitHeader(header http.Header, name string) (int64, bool) {
+	value := header.Get("RateLimit-" + name)
+	if value == "" {
+		value = header.Get("X-RateLimit-" + name)
+	}
+	if i := strings.IndexByte(value, ','); i >= 0 {
+		value = value[:i]
+	}
+
+	number, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	if err != nil || number < 0 {
+		return 0, false
+	}
+	return number, true
+}
+
+// rateLimitReset returns the time the quota will be reset.
+//
+// The reset header usually contains the seconds until the reset, but some APIs send a unix timestamp instead.
+func rateLimitReset(header http.Header, now time.Time) (time.Time, bool) {
+	reset, ok := rateLimitHeader(header, "Reset")
+	if !ok {
+		return time.Time{}, false
+	}
+	if reset > unixTimestampThreshold {
+		return time.Unix(reset, 0), true
+	}
+	return now.Add(time.Duration(reset) * time.Second), true
+}
+
+func minTime(a time.Time, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
+
+func minFloat(a float64, b float64) float64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxFloat(a float64, b float64) float64 {
+	if a > b {
+		return a
+	}
+	return b
+}
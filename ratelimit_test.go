@@ -0,0 +1,214 @@
+package httpretry
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	check := assert.New(t)
+
+	newRequest := func(url string) *http.Request {
+		req, _ := http.NewRequest("GET", url, nil)
+		return req
+	}
+
+	t.Run("should allow burst without waiting", func(t *testing.T) {
+		limiter := NewRateLimiter(1, 3, nil, 0)
+		req := newRequest("https://my-super-nonexisting-url.asd")
+
+		start := time.Now()
+		for i := 0; i < 3; i++ {
+			check.NoError(limiter.Wait(req))
+		}
+		check.Less(time.Since(start), 50*time.Millisecond)
+	})
+
+	t.Run("should wait for tokens after burst", func(t *testing.T) {
+		limiter := NewRateLimiter(20, 1, nil, 0)
+		req := newRequest("https://my-super-nonexisting-url.asd")
+
+		start := time.Now()
+		for i := 0; i < 3; i++ {
+			check.NoError(limiter.Wait(req))
+		}
+		check.GreaterOrEqual(time.Since(start), 90*time.Millisecond)
+	})
+
+	t.Run("should use separate buckets per host", func(t *testing.T) {
+		limiter := NewRateLimiter(1, 1, HostRateLimitKey, 0)
+
+		start := time.Now()
+		check.NoError(limiter.Wait(newRequest("https://host-a.asd")))
+		check.NoError(limiter.Wait(newRequest("https://host-b.asd")))
+		check.Less(time.Since(start), 50*time.Millisecond)
+		check.Len(limiter.buckets, 2)
+	})
+
+	t.Run("should return context error while waiting", func(t *testing.T) {
+		limiter := NewRateLimiter(0.1, 1, nil, 0)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		req, _ := http.NewRequestWithContext(ctx, "GET", "https://my-super-nonexisting-url.asd", nil)
+
+		check.NoError(limiter.Wait(req))
+		check.ErrorIs(limiter.Wait(req), context.DeadlineExceeded)
+	})
+
+	t.Run("should not wait beyond deadline", func(t *testing.T) {
+		limiter := NewRateLimiter(1, 1, nil, 0)
+		req := newRequest("https://my-super-nonexisting-url.asd")
+
+		check.NoError(limiter.Wait(req))
+		check.InDelta(time.Second, limiter.delay(req, time.Now()), float64(50*time.Millisecond))
+
+		start := time.Now()
+		check.ErrorIs(limiter.wait(req, time.Now().Add(100*time.Millisecond)), errWaitDeadline)
+		check.Less(time.Since(start), 10*time.Millisecond)
+		check.InDelta(0.0, limiter.buckets[""].tokens, 0.1, "should give back the token")
+	})
+
+	t.Run("should tighten on 429 and recover on success", func(t *testing.T) {
+		limiter := NewRateLimiter(10, 1, nil, 0)
+		req := newRequest("https://my-super-nonexisting-url.asd")
+
+		limiter.Observe(req, FakeResponse(req, http.StatusTooManyRequests, nil))
+		check.Equal(5.0, limiter.buckets[""].rate)
+
+		limiter.Observe(req, FakeResponse(req, http.StatusTooManyRequests, nil))
+		check.Equal(2.5, limiter.buckets[""].rate)
+
+		limiter.Observe(req, FakeResponse(req, http.StatusOK, nil))
+		check.InDelta(3.0, limiter.buckets[""].rate, 0.0001)
+
+		for i := 0; i < 100; i++ {
+			limiter.Observe(req, FakeResponse(req, http.StatusOK, nil))
+		}
+		check.Equal(10.0, limiter.buckets[""].rate)
+	})
+
+	t.Run("should block on Retry-After of 429", func(t *testing.T) {
+		limiter := NewRateLimiter(10, 1, nil, 0)
+		req := newRequest("https://my-super-nonexisting-url.asd")
+
+		resp := FakeResponse(req, http.StatusTooManyRequests, nil)
+		resp.Header = http.Header{"Retry-After": []string{"5"}}
+		limiter.Observe(req, resp)
+
+		check.WithinDuration(time.Now().Add(5*time.Second), limiter.buckets[""].blockedUntil, 100*time.Millisecond)
+	})
+
+	t.Run("should block if quota is exhausted", func(t *testing.T) {
+		limiter := NewRateLimiter(10, 1, nil, 0)
+		req := newRequest("https://my-super-nonexisting-url.asd")
+
+		resp := FakeResponse(req, http.StatusOK, nil)
+		resp.Header = http.Header{"Ratelimit-Remaining": []string{"0"}, "Ratelimit-Reset": []string{"3"}}
+		limiter.Observe(req, resp)
+
+		check.WithinDuration(time.Now().Add(3*time.Second), limiter.buckets[""].blockedUntil, 100*time.Millisecond)
+	})
+
+	t.Run("should spread remaining quota until reset", func(t *testing.T) {
+		limiter := NewRateLimiter(10, 1, nil, 0)
+		req := newRequest("https://my-super-nonexisting-url.asd")
+
+		resp := FakeResponse(req, http.StatusOK, nil)
+		reset := time.Now().Add(10 * time.Second).Unix()
+		resp.Header = http.Header{"X-Ratelimit-Remaining": []string{"20"}, "X-Ratelimit-Reset": []string{strconv.FormatInt(reset, 10)}}
+		limiter.Observe(req, resp)
+
+		check.InDelta(2.0, limiter.buckets[""].rate, 0.3)
+	})
+
+	t.Run("should recover if remaining quota is reported without reset", func(t *testing.T) {
+		limiter := NewRateLimiter(10, 1, nil, 0)
+		req := newRequest("https://my-super-nonexisting-url.asd")
+
+		limiter.Observe(req, FakeResponse(req, http.StatusTooManyRequests, nil))
+		check.Equal(5.0, limiter.buckets[""].rate)
+
+		resp := FakeResponse(req, http.StatusOK, nil)
+		resp.Header = http.Header{"Ratelimit-Remaining": []string{"20"}}
+		limiter.Observe(req, resp)
+
+		check.InDelta(5.5, limiter.buckets[""].rate, 0.0001)
+	})
+
+	t.Run("should cap block of huge Retry-After and reset headers", func(t *testing.T) {
+		limiter := NewRateLimiter(10, 1, nil, time.Second)
+		req := newRequest("https://my-super-nonexisting-url.asd")
+
+		resp := FakeResponse(req, http.StatusTooManyRequests, nil)
+		resp.Header = http.Header{"Retry-After": []string{"99999999999"}}
+		limiter.Observe(req, resp)
+		check.WithinDuration(time.Now().Add(time.Second), limiter.buckets[""].blockedUntil, 100*time.Millisecond)
+
+		resp = FakeResponse(req, http.StatusOK, nil)
+		resp.Header = http.Header{"Ratelimit-Remaining": []string{"0"}, "Ratelimit-Reset": []string{"99999999999"}}
+		limiter.Observe(req, resp)
+		check.WithinDuration(time.Now().Add(time.Second), limiter.buckets[""].blockedUntil, 100*time.Millisecond)
+	})
+
+	t.Run("should forget idle buckets", func(t *testing.T) {
+		limiter := NewRateLimiter(10, 1, HostRateLimitKey, 0)
+		check.NoError(limiter.Wait(newRequest("https://host-a.asd")))
+		check.NoError(limiter.Wait(newRequest("https://host-b.asd")))
+
+		resp := FakeResponse(nil, http.StatusTooManyRequests, nil)
+		resp.Header = http.Header{"Retry-After": []string{"3600"}}
+		limiter.Observe(newRequest("https://host-b.asd"), resp)
+
+		// pretend both buckets were idle since the last sweep
+		idle := time.Now().Add(-2 * bucketIdleTimeout)
+		limiter.lastSweep = idle
+		for _, b := range limiter.buckets {
+			b.last = idle
+		}
+
+		check.NoError(limiter.Wait(newRequest("https://host-c.asd")))
+		check.Len(limiter.buckets, 2, "blocked bucket should be kept")
+		check.Contains(limiter.buckets, "host-b.asd")
+		check.Contains(limiter.buckets, "host-c.asd")
+	})
+}
+
+func TestRetryRoundtripperRateLimiter(t *testing.T) {
+	check := assert.New(t)
+
+	mockRoundtripper := &MockRoundtripper{}
+	limiter := NewRateLimiter(10, 1, nil, 0)
+
+	retryRoundtripper := RetryRoundtripper{
+		MaxRetryCount:    3,
+		Next:             mockRoundtripper,
+		ShouldRetry:      (&MockRetryPolicy{}).ShouldRetry,
+		CalculateBackoff: ConstantBackoff(0, 0),
+		RateLimiter:      limiter,
+	}
+
+	t.Run("should gate retries", func(t *testing.T) {
+		mockRoundtripper.RoundTripFunc = func(req *http.Request, called int) (response *http.Response, e error) {
+			switch called {
+			case 1, 2:
+				return FakeResponse(req, 500, []byte("error")), nil
+			default:
+				return FakeResponse(req, 200, []byte("ok")), nil
+			}
+		}
+
+		start := time.Now()
+		req, _ := http.NewRequest("GET", "https://my-super-nonexisting-url.asd", nil)
+		res, err := retryRoundtripper.RoundTrip(req)
+
+		check.NoError(err)
+		check.Equal(200, res.StatusCode)
+		check.Equal(3, mockRoundtripper.CallCount)
+		// the burst allows the first attempt, the two retries have to wait 100ms each
+		check.GreaterOrEqual(time.Since(start), 190*time.Millisecond)
+	})
+}
@@ -0,0 +1,138 @@
+package httpretry
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+const (
+	// DefaultMaxRedirects is the redirect limit of the http.Client, which is also used by WithRedirects if maxRedirects <= 0
+	DefaultMaxRedirects = 10
+)
+
+// RedirectPolicy decides if a redirect should be followed, it works like http.Client.CheckRedirect.
+//
+// req is the upcoming request, via contains the requests that were already sent, the oldest first.
+// If http.ErrUseLastResponse is returned, the redirect response is returned without following it,
+// any other error aborts the attempt with this error.
+type RedirectPolicy func(req *http.Request, via []*http.Request) error
+
+// TooManyRedirectsError is returned if the redirect limit was reached while following redirects.
+//
+// It is classified as ErrorClassTooManyRedirects.
+type TooManyRedirectsError struct {
+	MaxRedirects int
+	URL          string
+}
+
+func (e *TooManyRedirectsError) Error() string {
+	return fmt.Sprintf("stopped after %d redirects at %s", e.MaxRedirects, e.URL)
+}
+
+// redirectHeaders are removed if a redirect points to a different host, since they would leak credentials
+var redirectHeaders = []string{"Authorization", "Www-Authenticate", "Cookie", "Cookie2", "Proxy-Authorization"}
+
+// send sends the attempt and follows the redirects if FollowRedirects is set, so the whole chain is one attempt.
+func (r *RetryRoundtripper) send(req *http.Request) (*http.Response, error) {
+	resp, err := r.attempt(req)
+	if !r.FollowRedirects {
+		return resp, err
+	}
+
+	var via []*http.Request
+	for err == nil {
+		next, redirectErr := redirectRequest(req, resp)
+		if next == nil && redirectErr == nil {
+			return resp, nil
+		}
+		if redirectErr != nil {
+			r.drainBody(resp)
+			return nil, redirectErr
+		}
+
+		if len(via) >= r.MaxRedirects {
+			r.drainBody(resp)
+			return nil, &TooManyRedirectsError{MaxRedirects: r.MaxRedirects, URL: next.URL.String()}
+		}
+		via = append(via, req)
+
+		if r.CheckRedirect != nil {
+			if checkErr := r.CheckRedirect(next, via); checkErr != nil {
+				if errors.Is(checkErr, http.ErrUseLastResponse) {
+					return resp, nil
+				}
+				r.drainBody(resp)
+				return nil, checkErr
+			}
+		}
+
+		r.drainBody(resp)
+		req = next
+		resp, err = r.attempt(req)
+	}
+	return resp, err
+}
+
+// redirectRequest returns the request that follows the redirect response, or nil if the response is no redirect.
+//
+// Like the http.Client, 301, 302 and 303 are followed with GET (or HEAD) without body,
+// 307 and 308 are followed with the same method and the replayed body.
+func redirectRequest(req *http.Request, resp *http.Response) (*http.Request, error) {
+	var (
+		method      = req.Method
+		includeBody bool
+	)
+	switch resp.StatusCode {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther:
+		if method != http.MethodGet && method != http.MethodHead {
+			method = http.MethodGet
+		}
+	case http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		includeBody = true
+		if req.GetBody == nil && req.Body != nil && req.Body != http.NoBody {
+			// the body can not be replayed, so the redirect response is returned like the http.Client does
+			return nil, nil
+		}
+	default:
+		return nil, nil
+	}
+
+	location := resp.Header.Get("Location")
+	if location == "" {
+		return nil, nil
+	}
+	u, err := req.URL.Parse(location)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse Location header %q: %w", location, err)
+	}
+
+	next := req.Clone(req.Context())
+	next.Method = method
+	next.URL = u
+	next.Host = ""
+
+	if includeBody && req.GetBody != nil {
+		if next.Body, err = req.GetBody(); err != nil {
+			return nil, err
+		}
+	} else {
+		next.Body = nil
+		next.GetBody = nil
+		next.ContentLength = 0
+		next.Header.Del("Content-Type")
+	}
+
+	if u.Hostname() != req.URL.Hostname() {
+		for _, header := range redirectHeaders {
+			next.Header.Del(header)
+		}
+	}
+
+	return next, nil
+}
+
+// stopRedirects is used as http.Client.CheckRedirect if the retry roundtripper follows the redirects.
+func stopRedirects(*http.Request, []*http.Request) error {
+	return http.ErrUseLastResponse
+}
@@ -0,0 +1,190 @@
+package httpretry
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRetryRoundtripperRedirects(t *testing.T) {
+	check := assert.New(t)
+
+	redirect := func(req *http.Request, statusCode int, location string) *http.Response {
+		resp := FakeResponse(req, statusCode, []byte("redirect"))
+		resp.Header = http.Header{"Location": []string{location}}
+		return resp
+	}
+
+	mockRoundtripper := &MockRoundtripper{}
+
+	retryRoundtripper := RetryRoundtripper{
+		MaxRetryCount:    3,
+		Next:             mockRoundtripper,
+		ShouldRetry:      (&MockRetryPolicy{}).ShouldRetry,
+		CalculateBackoff: (&MockBackoffPolicy{}).CalculateBackoff,
+	}
+	WithRedirects(DefaultMaxRedirects, nil)(&retryRoundtripper)
+
+	t.Run("should follow 303 with GET and 307 with body", func(t *testing.T) {
+		mockRoundtripper.reset()
+		var sent []string
+		mockRoundtripper.RoundTripFunc = func(req *http.Request, called int) (response *http.Response, e error) {
+			var body []byte
+			if req.Body != nil {
+				body, _ = io.ReadAll(req.Body)
+			}
+			sent = append(sent, req.Method+" "+req.URL.String()+" "+string(body))
+			switch req.URL.Path {
+			case "/a":
+				return redirect(req, http.StatusTemporaryRedirect, "/b"), nil
+			case "/b":
+				return redirect(req, http.StatusSeeOther, "https://other.asd/c"), nil
+			default:
+				return FakeResponse(req, 200, []byte("ok")), nil
+			}
+		}
+
+		req, _ := http.NewRequest("POST", "https://my-super-nonexisting-url.asd/a", strings.NewReader("body"))
+		res, err := retryRoundtripper.RoundTrip(req)
+
+		check.NoError(err)
+		check.Equal(200, res.StatusCode)
+		check.Equal([]string{
+			"POST https://my-super-nonexisting-url.asd/a body",
+			"POST https://my-super-nonexisting-url.asd/b body",
+			"GET https://other.asd/c ",
+		}, sent)
+	})
+
+	t.Run("should strip credentials on cross host redirects", func(t *testing.T) {
+		mockRoundtripper.reset()
+		var sent []http.Header
+		mockRoundtripper.RoundTripFunc = func(req *http.Request, called int) (response *http.Response, e error) {
+			sent = append(sent, req.Header)
+			switch called {
+			case 1:
+				return redirect(req, http.StatusFound, "/same-host"), nil
+			case 2:
+				return redirect(req, http.StatusFound, "https://other.asd/"), nil
+			default:
+				return FakeResponse(req, 200, []byte("ok")), nil
+			}
+		}
+
+		req, _ := http.NewRequest("GET", "https://my-super-nonexisting-url.asd", nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		req.Header.Set("Cookie", "session=secret")
+		req.Header.Set("X-Custom", "value")
+		_, err := retryRoundtripper.RoundTrip(req)
+
+		check.NoError(err)
+		check.Len(sent, 3)
+		check.Equal("Bearer secret", sent[1].Get("Authorization"))
+		check.Empty(sent[2].Get("Authorization"))
+		check.Empty(sent[2].Get("Cookie"))
+		check.Equal("value", sent[2].Get("X-Custom"))
+	})
+
+	t.Run("should retry the whole redirect chain", func(t *testing.T) {
+		mockRoundtripper.reset()
+		var paths []string
+		mockRoundtripper.RoundTripFunc = func(req *http.Request, called int) (response *http.Response, e error) {
+			paths = append(paths, req.URL.Path)
+			switch {
+			case req.URL.Path == "/a":
+				return redirect(req, http.StatusMovedPermanently, "/b"), nil
+			case called == 2:
+				return FakeResponse(req, 500, []byte("error")), nil
+			default:
+				return FakeResponse(req, 200, []byte("ok")), nil
+			}
+		}
+
+		req, _ := http.NewRequest("GET", "https://my-super-nonexisting-url.asd/a", nil)
+		res, err := retryRoundtripper.RoundTrip(req)
+
+		check.NoError(err)
+		check.Equal(200, res.StatusCode)
+		check.Equal([]string{"/a", "/b", "/a", "/b"}, paths)
+	})
+
+	t.Run("should use default limit if no limit is given", func(t *testing.T) {
+		for _, maxRedirects := range []int{0, -1} {
+			rt := retryRoundtripper.clone()
+			WithRedirects(maxRedirects, nil)(rt)
+			check.Equal(DefaultMaxRedirects, rt.MaxRedirects)
+		}
+	})
+
+	t.Run("should return typed error on too many redirects", func(t *testing.T) {
+		mockRoundtripper.reset()
+		mockRoundtripper.RoundTripFunc = func(req *http.Request, called int) (response *http.Response, e error) {
+			return redirect(req, http.StatusFound, "/loop"), nil
+		}
+
+		rt := retryRoundtripper.clone()
+		WithRedirects(2, nil)(rt)
+		rt.ShouldRetry = DefaultRetryPolicy
+
+		req, _ := http.NewRequest("GET", "https://my-super-nonexisting-url.asd", nil)
+		res, err := rt.RoundTrip(req)
+
+		var tooManyRedirectsErr *TooManyRedirectsError
+		check.Nil(res)
+		check.True(errors.As(err, &tooManyRedirectsErr))
+		check.Equal(2, tooManyRedirectsErr.MaxRedirects)
+		check.Equal(ErrorClassTooManyRedirects, ClassifyError(err))
+		check.Equal(3, mockRoundtripper.CallCount, "should not retry too many redirects")
+	})
+
+	t.Run("should stop following redirects by policy", func(t *testing.T) {
+		mockRoundtripper.reset()
+		mockRoundtripper.RoundTripFunc = func(req *http.Request, called int) (response *http.Response, e error) {
+			return redirect(req, http.StatusFound, "https://other.asd/"), nil
+		}
+
+		rt := retryRoundtripper.clone()
+		WithRedirects(DefaultMaxRedirects, func(req *http.Request, via []*http.Request) error {
+			if req.URL.Host != via[0].URL.Host {
+				return http.ErrUseLastResponse
+			}
+			return nil
+		})(rt)
+
+		req, _ := http.NewRequest("GET", "https://my-super-nonexisting-url.asd", nil)
+		res, err := rt.RoundTrip(req)
+
+		check.NoError(err)
+		check.Equal(http.StatusFound, res.StatusCode)
+		check.Equal(1, mockRoundtripper.CallCount)
+
+		rt.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+			return errors.New("redirect forbidden")
+		}
+		res, err = rt.RoundTrip(req)
+		check.Nil(res)
+		check.EqualError(err, "redirect forbidden")
+	})
+
+	t.Run("should not follow redirects in client", func(t *testing.T) {
+		var hops int
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			hops++
+			http.Redirect(w, r, "/loop", http.StatusFound)
+		}))
+		defer server.Close()
+
+		client := NewDefaultClient(WithRedirects(3, nil), WithMaxRetryCount(0))
+		check.NotNil(client.CheckRedirect)
+
+		_, err := client.Get(server.URL)
+
+		var tooManyRedirectsErr *TooManyRedirectsError
+		check.True(errors.As(err, &tooManyRedirectsErr))
+		check.Equal(4, hops)
+	})
+}
@@ -0,0 +1,91 @@
+package httpretry
+
+import (
+	"context"
+	"os"
+	"time"
+)
+
+// ConfigProvider provides the options of a retry configuration (e.g. *Config).
+type ConfigProvider interface {
+	Options() ([]Option, error)
+}
+
+// Reload atomically replaces the configuration with the base configuration and the options of the provider applied on top.
+//
+// In contrast to Update(), settings that are no longer provided fall back to the base configuration.
+// If the provider returns an error, the configuration is not changed.
+func (r *RetryRoundtripper) Reload(base *RetryRoundtripper, provider ConfigProvider) error {
+	opts, err := provider.Options()
+	if err != nil {
+		return err
+	}
+
+	config := base.snapshot()
+	for _, o := range opts {
+		o(config)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	copyConfig(r, config)
+	return nil
+}
+
+// WatchConfigFile loads the JSON or YAML configuration file (see LoadConfigFile()) and reloads the configuration
+// whenever the file changed. The file is polled in the given interval until the context is done.
+//
+// The configuration of the file is applied on top of the configuration the retry roundtripper had when the watch started.
+// Errors (e.g. an invalid file) are reported to onError (optional) and the last valid configuration stays active.
+// Replace the file atomically (write a temporary file and rename it), otherwise a partially written file may be reported.
+//
+// WatchConfigFile blocks, so it should be started in its own goroutine:
+//
+//	go retryRoundtripper.WatchConfigFile(ctx, "retry.yaml", 10*time.Second, func(err error) { log.Println(err) })
+func (r *RetryRoundtripper) WatchConfigFile(ctx context.Context, path string, interval time.Duration, onError func(error)) {
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	if onError == nil {
+		onError = func(error) {}
+	}
+
+	base := r.snapshot()
+	var lastModTime time.Time
+	var lastSize int64 = -1
+
+	reload := func() {
+		info, err := os.Stat(path)
+		if err != nil {
+			onError(err)
+			return
+		}
+		if info.ModTime().Equal(lastModTime) && info.Size() == lastSize {
+			return
+		}
+		// errors are reported only once per change of the file
+		lastModTime, lastSize = info.ModTime(), info.Size()
+
+		config, err := LoadConfigFile(path)
+		if err == nil {
+			err = r.Reload(base, config)
+		}
+		if err != nil {
+			onError(err)
+		}
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	reload()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			reload()
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package httpretry
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRetryRoundtripperUpdate(t *testing.T) {
+	check := assert.New(t)
+
+	t.Run("should apply options on top of current configuration", func(t *testing.T) {
+		client := NewDefaultClient(WithMaxRetryCount(2))
+		rt := client.Transport.(*RetryRoundtripper)
+
+		rt.Update(WithMaxRetryCount(7))
+
+		check.Equal(7, rt.MaxRetryCount)
+		check.NotNil(rt.ShouldRetry)
+		check.NotNil(rt.CalculateBackoff)
+	})
+
+	t.Run("should be safe to update while requests are in flight", func(t *testing.T) {
+		mockRoundtripper := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			return FakeResponse(req, 500, []byte("error")), nil
+		})
+		rt := NewCustomClient(&http.Client{Transport: mockRoundtripper},
+			WithBackoffPolicy(ConstantBackoff(0, 0)),
+			WithMaxRetryCount(1),
+		).Transport.(*RetryRoundtripper)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		var wg sync.WaitGroup
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for ctx.Err() == nil {
+					req, _ := http.NewRequest("GET", "https://my-super-nonexisting-url.asd", nil)
+					res, err := rt.RoundTrip(req)
+					check.NoError(err)
+					check.Equal(500, res.StatusCode)
+				}
+			}()
+		}
+
+		for i := 0; i < 100; i++ {
+			rt.Update(WithMaxRetryCount(i%3), WithHostOptions("my-super-nonexisting-url.asd", WithMaxRetryCount(0)))
+		}
+		cancel()
+		wg.Wait()
+	})
+}
+
+func TestRetryRoundtripperReload(t *testing.T) {
+	check := assert.New(t)
+
+	t.Run("should fall back to base configuration", func(t *testing.T) {
+		rt := NewDefaultClient(WithMaxRetryCount(2)).Transport.(*RetryRoundtripper)
+		base := rt.snapshot()
+
+		maxRetries := 9
+		check.NoError(rt.Reload(base, &Config{RetryConfig: RetryConfig{MaxRetries: &maxRetries}}))
+		check.Equal(9, rt.MaxRetryCount)
+
+		check.NoError(rt.Reload(base, &Config{}))
+		check.Equal(2, rt.MaxRetryCount)
+	})
+
+	t.Run("should keep configuration on error", func(t *testing.T) {
+		rt := NewDefaultClient(WithMaxRetryCount(2)).Transport.(*RetryRoundtripper)
+
+		maxRetries := -1
+		check.Error(rt.Reload(rt.snapshot(), &Config{RetryConfig: RetryConfig{MaxRetries: &maxRetries}}))
+		check.Equal(2, rt.MaxRetryCount)
+	})
+}
+
+func TestRetryRoundtripperWatchConfigFile(t *testing.T) {
+	check := assert.New(t)
+
+	path := filepath.Join(t.TempDir(), "retry.json")
+	check.NoError(os.WriteFile(path, []byte(`{"maxRetries": 3}`), 0o600))
+
+	rt := NewDefaultClient(WithMaxRetryCount(1)).Transport.(*RetryRoundtripper)
+	currentMaxRetryCount := func() int {
+		return rt.snapshot().MaxRetryCount
+	}
+
+	errs := make(chan error, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		rt.WatchConfigFile(ctx, path, 5*time.Millisecond, func(err error) { errs <- err })
+		close(done)
+	}()
+
+	check.Eventually(func() bool { return currentMaxRetryCount() == 3 }, time.Second, 5*time.Millisecond)
+
+	writeFileAtomically(t, path, `{"maxRetries": 10}`)
+	check.Eventually(func() bool { return currentMaxRetryCount() == 10 }, time.Second, 5*time.Millisecond)
+
+	writeFileAtomically(t, path, `{"maxRetries": -5}`)
+	select {
+	case err := <-errs:
+		check.ErrorContains(err, "maxRetries")
+	case <-time.After(time.Second):
+		t.Fatal("expected error for invalid config")
+	}
+	check.Equal(10, currentMaxRetryCount())
+
+	cancel()
+	<-done
+}
+
+// writeFileAtomically replaces the file by renaming a temporary file, so a watcher never reads a partially written file.
+func writeFileAtomically(t *testing.T, path string, content string) {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -1,10 +1,7 @@
 package httpretry
 
 import (
-	"crypto/x509"
 	"net/http"
-	"net/url"
-	"strings"
 )
 
 // RetryPolicy decides if a request should be retried.
@@ -14,40 +11,18 @@ import (
 // The statusCode may be 0 if there was no response available (e.g. in case of a request error).
 type RetryPolicy func(statusCode int, err error) bool
 
-var defaultRetryPolicy RetryPolicy = func(statusCode int, err error) bool {
-	// check if error is of type temporary
-	t, ok := err.(interface{ Temporary() bool })
-	if ok && t.Temporary() {
-		return true
-	}
-
-	// we cannot know all errors, so we filter errors that should NOT be retried
-	switch e := err.(type) {
-	case *url.Error:
-		switch {
-		case
-			e.Op == "parse",
-			strings.Contains(e.Err.Error(), "stopped after"),
-			strings.Contains(e.Error(), "unsupported protocol scheme"),
-			strings.Contains(e.Error(), "no Host in request URL"):
-			return false
-		}
-		// check inner error of url.Error
-		switch e.Err.(type) {
-		case // this errors will not likely change when retrying
-			x509.UnknownAuthorityError,
-			x509.CertificateInvalidError,
-			x509.ConstraintViolationError:
-			return false
-		}
-	case error: // generic error, check for strings if nothing found, retry
-		return true
-	case nil: // no error, continue
-	}
+var (
+	// DefaultRetryPolicy checks for some common errors that are likely not retryable and for status codes
+	// that should be retried.
+	//
+	// It retries on temporary errors, on connection errors (except certificate errors)
+	// and on the status codes in DefaultRetryableStatusCodes.
+	DefaultRetryPolicy = defaultRetryPolicyWithStatus(DefaultRetryableStatusCodes...)
 
-	// most of the codes should not be retried, so we filter status codes that SHOULD be retried
-	switch statusCode {
-	case // status codes that should be retried
+	// DefaultRetryableStatusCodes are the status codes that will be retried by the DefaultRetryPolicy.
+	//
+	// Changing this slice does not affect the DefaultRetryPolicy, use RetryOnStatus() to build your own policy.
+	DefaultRetryableStatusCodes = []int{
 		http.StatusRequestTimeout,
 		http.StatusConflict,
 		http.StatusLocked,
@@ -56,11 +31,133 @@ var defaultRetryPolicy RetryPolicy = func(statusCode int, err error) bool {
 		http.StatusBadGateway,
 		http.StatusServiceUnavailable,
 		http.StatusGatewayTimeout,
-		http.StatusInsufficientStorage:
-		return true
-	case 0: // means we did not get a response. we need to retry
-		return true
-	default: // on all other status codes we should not retry (e.g. 200, 401 etc.)
+		http.StatusInsufficientStorage,
+	}
+
+	// RetryOnTemporaryErrors retries on errors that are classified as temporary (including timeouts and temporary DNS failures).
+	RetryOnTemporaryErrors RetryPolicy = func(statusCode int, err error) bool {
+		switch ClassifyError(err) {
+		case ErrorClassTemporary, ErrorClassTimeout, ErrorClassDNSTemporary:
+			return true
+		default:
+			return false
+		}
+	}
+
+	// RetryOnConnectionErrors retries if no response was received and the error may succeed when retrying
+	// (e.g. connection refused, connection reset, timeout etc.).
+	//
+	// Errors that will not likely change when retrying are not retried (see ErrorClass.Retryable()):
+	//  - url parsing errors
+	//  - too many redirects
+	//  - request urls without scheme or host, or with a scheme the http.Transport does not support
+	//  - unknown host (NXDOMAIN)
+	//  - tls and certificate errors
+	RetryOnConnectionErrors RetryPolicy = func(statusCode int, err error) bool {
+		if err == nil {
+			// no error but also no response, we need to retry
+			return statusCode == 0
+		}
+
+		return ClassifyError(err).Retryable()
+	}
+
+	// NeverRetryCertErrors vetoes retries on certificate errors, since they will not likely change when retrying.
+	//
+	// It returns false on certificate errors and true otherwise, so it should be combined with All().
+	//
+	// Example:
+	//   All(NeverRetryCertErrors, RetryOnConnectionErrors)
+	NeverRetryCertErrors RetryPolicy = func(statusCode int, err error) bool {
+		return ClassifyError(err) != ErrorClassCertificate
+	}
+)
+
+// defaultRetryPolicyWithStatus returns the DefaultRetryPolicy with the provided retryable status codes.
+func defaultRetryPolicyWithStatus(statusCodes ...int) RetryPolicy {
+	return Any(
+		RetryOnTemporaryErrors,
+		All(NeverRetryCertErrors, RetryOnConnectionErrors),
+		RetryOnStatus(statusCodes...),
+	)
+}
+
+// RetryOnStatus retries if a response with one of the provided status codes was received.
+func RetryOnStatus(statusCodes ...int) RetryPolicy {
+	codes := make(map[int]struct{}, len(statusCodes))
+	for _, code := range statusCodes {
+		codes[code] = struct{}{}
+	}
+	return func(statusCode int, err error) bool {
+		if err != nil {
+			return false
+		}
+		_, ok := codes[statusCode]
+		return ok
+	}
+}
+
+// RetryOnErrorClasses retries if the error is classified as one of the provided error classes.
+func RetryOnErrorClasses(classes ...ErrorClass) RetryPolicy {
+	return func(statusCode int, err error) bool {
+		class := ClassifyError(err)
+		for _, c := range classes {
+			if class == c {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Any retries if at least one of the provided policies wants to retry.
+func Any(policies ...RetryPolicy) RetryPolicy {
+	return func(statusCode int, err error) bool {
+		for _, policy := range policies {
+			if policy(statusCode, err) {
+				return true
+			}
+		}
 		return false
 	}
 }
+
+// All retries if all provided policies want to retry.
+//
+// If no policy is provided, it will not retry.
+func All(policies ...RetryPolicy) RetryPolicy {
+	return func(statusCode int, err error) bool {
+		for _, policy := range policies {
+			if !policy(statusCode, err) {
+				return false
+			}
+		}
+		return len(policies) > 0
+	}
+}
+
+// Not inverts the decision of the provided policy.
+func Not(policy RetryPolicy) RetryPolicy {
+	return func(statusCode int, err error) bool {
+		return !policy(statusCode, err)
+	}
+}
+
+// Except retries if the policy wants to retry and none of the exceptions match.
+//
+// Example (retry like the default policy, but not on 409 Conflict):
+//
+//	Except(DefaultRetryPolicy, RetryOnStatus(http.StatusConflict))
+func Except(policy RetryPolicy, exceptions ...RetryPolicy) RetryPolicy {
+	return func(statusCode int, err error) bool {
+		if !policy(statusCode, err) {
+			return false
+		}
+		for _, exception := range exceptions {
+			if exception(statusCode, err) {
+				return false
+			}
+		}
+		return true
+	}
+}
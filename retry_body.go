@@ -0,0 +1,140 @@
+package httpretry
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+const (
+	defaultBodyPeekLimit = 4096
+)
+
+// BodyRetryPolicy decides if a request should be retried by examining the beginning of the response body.
+//
+// It is only called if the RetryPolicy decided not to retry and a response was received.
+// The body contains at most the configured number of bytes, so it may be truncated.
+//
+// RoundTrip blocks until the configured number of bytes or the end of the body was received,
+// so it stalls streaming responses like server-sent events or long polling.
+type BodyRetryPolicy func(statusCode int, body []byte) bool
+
+// RetryOnJSONField retries if the json response body contains the field at the given path with one of the provided values.
+//
+// The path separates nested fields by dots (e.g. "error.code"). Values are compared by their string representation.
+// If no values are provided, the request is retried if the field is present and not null.
+//
+// Example (retry on {"error":"throttled"}):
+//
+//	RetryOnJSONField("error", "throttled")
+func RetryOnJSONField(path string, values ...string) BodyRetryPolicy {
+	fields := strings.Split(path, ".")
+	return func(statusCode int, body []byte) bool {
+		var data interface{}
+		if err := json.Unmarshal(body, &data); err != nil {
+			return false
+		}
+
+		for _, field := range fields {
+			object, ok := data.(map[string]interface{})
+			if !ok {
+				return false
+			}
+			if data, ok = object[field]; !ok {
+				return false
+			}
+		}
+
+		if data == nil {
+			return false
+		}
+		if len(values) == 0 {
+			return true
+		}
+		return containsString(values, fmt.Sprint(data))
+	}
+}
+
+// RetryOnGraphQLErrorCodes retries if the GraphQL response body contains an error with one of the provided extensions codes.
+//
+// Example (retry on {"errors":[{"message":"...","extensions":{"code":"RATE_LIMITED"}}]}):
+//
+//	RetryOnGraphQLErrorCodes("RATE_LIMITED", "SERVICE_UNAVAILABLE")
+func RetryOnGraphQLErrorCodes(codes ...string) BodyRetryPolicy {
+	return func(statusCode int, body []byte) bool {
+		var data struct {
+			Errors []struct {
+				Extensions struct {
+					Code string `json:"code"`
+				} `json:"extensions"`
+			} `json:"errors"`
+		}
+		if err := json.Unmarshal(body, &data); err != nil {
+			return false
+		}
+
+		for _, e := range data.Errors {
+			if containsString(codes, e.Extensions.Code) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// shouldRetryBody reads up to limit bytes of the response body and asks the policy whether to retry.
+//
+// The response body is restored afterwards, so the caller is still able to read the complete body.
+func shouldRetryBody(policy BodyRetryPolicy, limit int64, resp *http.Response) bool {
+	if resp == nil || resp.Body == nil || resp.Body == http.NoBody {
+		return false
+	}
+	if limit <= 0 {
+		limit = defaultBodyPeekLimit
+	}
+
+	// a read error is returned to the caller after the prefix, when reading the restored body
+	prefix, err := io.ReadAll(io.LimitReader(resp.Body, limit))
+	resp.Body = newPeekedBody(prefix, resp.Body, err)
+
+	return policy(resp.StatusCode, prefix)
+}
+
+// peekedBody restores an already read prefix of the response body in front of the remaining body.
+type peekedBody struct {
+	io.Reader
+	io.Closer
+}
+
+// newPeekedBody returns the prefix followed by the remaining body, or by err if reading the prefix failed.
+func newPeekedBody(prefix []byte, body io.ReadCloser, err error) *peekedBody {
+	var remaining io.Reader = body
+	if err != nil {
+		remaining = &errorReader{err: err}
+	}
+	return &peekedBody{
+		Reader: io.MultiReader(bytes.NewReader(prefix), remaining),
+		Closer: body,
+	}
+}
+
+// errorReader fails every read with err.
+type errorReader struct {
+	err error
+}
+
+func (r *errorReader) Read([]byte) (int, error) {
+	return 0, r.err
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,155 @@
+package httpretry
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestRetryOnJSONField(t *testing.T) {
+	check := assert.New(t)
+
+	t.Run("should retry on matching field value", func(t *testing.T) {
+		policy := RetryOnJSONField("error", "throttled", "busy")
+
+		check.True(policy(200, []byte(`{"error":"throttled"}`)))
+		check.True(policy(200, []byte(`{"error":"busy"}`)))
+		check.False(policy(200, []byte(`{"error":"invalid"}`)))
+		check.False(policy(200, []byte(`{"result":"ok"}`)))
+	})
+
+	t.Run("should retry on nested fields", func(t *testing.T) {
+		policy := RetryOnJSONField("error.code", "429")
+
+		check.True(policy(200, []byte(`{"error":{"code":429}}`)))
+		check.False(policy(200, []byte(`{"error":"429"}`)))
+	})
+
+	t.Run("should retry on present field without values", func(t *testing.T) {
+		policy := RetryOnJSONField("error")
+
+		check.True(policy(200, []byte(`{"error":"anything"}`)))
+		check.False(policy(200, []byte(`{"error":null}`)))
+	})
+
+	t.Run("should not retry on invalid or truncated json", func(t *testing.T) {
+		policy := RetryOnJSONField("error")
+
+		check.False(policy(200, []byte(`{"error":"thrott`)))
+		check.False(policy(200, []byte(`not json`)))
+		check.False(policy(200, nil))
+	})
+}
+
+func TestRetryOnGraphQLErrorCodes(t *testing.T) {
+	check := assert.New(t)
+
+	policy := RetryOnGraphQLErrorCodes("RATE_LIMITED")
+
+	check.True(policy(200, []byte(`{"data":null,"errors":[{"message":"a"},{"message":"b","extensions":{"code":"RATE_LIMITED"}}]}`)))
+	check.False(policy(200, []byte(`{"data":null,"errors":[{"message":"a","extensions":{"code":"FORBIDDEN"}}]}`)))
+	check.False(policy(200, []byte(`{"data":{"x":1}}`)))
+	check.False(policy(200, []byte(`{"errors":`)))
+}
+
+func TestRetryRoundtripperBodyRetryPolicy(t *testing.T) {
+	check := assert.New(t)
+
+	mockRoundtripper := &MockRoundtripper{}
+	mockBackoffPolicy := &MockBackoffPolicy{}
+	mockRetryPolicy := &MockRetryPolicy{}
+
+	retryRoundtripper := RetryRoundtripper{
+		MaxRetryCount:    3,
+		Next:             mockRoundtripper,
+		ShouldRetry:      mockRetryPolicy.ShouldRetry,
+		CalculateBackoff: mockBackoffPolicy.CalculateBackoff,
+	}
+	WithBodyRetryPolicy(8, RetryOnJSONField("error", "throttled"))(&retryRoundtripper)
+
+	reset := func() {
+		mockRoundtripper.reset()
+		mockBackoffPolicy.reset()
+		mockRetryPolicy.reset()
+	}
+
+	t.Run("should retry if body policy matches", func(t *testing.T) {
+		reset()
+		retryRoundtripper.BodyPeekLimit = 1024
+		mockRoundtripper.RoundTripFunc = func(req *http.Request, called int) (response *http.Response, e error) {
+			switch called {
+			case 1:
+				return FakeResponse(req, 200, []byte(`{"error":"throttled"}`)), nil
+			default:
+				return FakeResponse(req, 200, []byte(`{"result":"ok"}`)), nil
+			}
+		}
+
+		req, _ := http.NewRequest("GET", "https://my-super-nonexisting-url.asd", nil)
+		res, err := retryRoundtripper.RoundTrip(req)
+
+		check.NoError(err)
+		check.Equal(2, mockRoundtripper.CallCount)
+		body, _ := io.ReadAll(res.Body)
+		check.Equal(`{"result":"ok"}`, string(body))
+	})
+
+	t.Run("should restore complete body if peek limit is smaller than body", func(t *testing.T) {
+		reset()
+		retryRoundtripper.BodyPeekLimit = 4
+		mockRoundtripper.RoundTripFunc = func(req *http.Request, called int) (response *http.Response, e error) {
+			return FakeResponse(req, 200, []byte(`{"error":"throttled"}`)), nil
+		}
+
+		req, _ := http.NewRequest("GET", "https://my-super-nonexisting-url.asd", nil)
+		res, err := retryRoundtripper.RoundTrip(req)
+
+		check.NoError(err)
+		check.Equal(1, mockRoundtripper.CallCount)
+		body, _ := io.ReadAll(res.Body)
+		check.Equal(`{"error":"throttled"}`, string(body))
+	})
+
+	t.Run("should return restored body of last response after retries are over", func(t *testing.T) {
+		reset()
+		retryRoundtripper.BodyPeekLimit = 1024
+		mockRoundtripper.RoundTripFunc = func(req *http.Request, called int) (response *http.Response, e error) {
+			return FakeResponse(req, 200, []byte(`{"error":"throttled"}`)), nil
+		}
+
+		req, _ := http.NewRequest("GET", "https://my-super-nonexisting-url.asd", nil)
+		res, err := retryRoundtripper.RoundTrip(req)
+
+		check.NoError(err)
+		check.Equal(4, mockRoundtripper.CallCount)
+		body, _ := io.ReadAll(res.Body)
+		check.Equal(`{"error":"throttled"}`, string(body))
+	})
+	t.Run("should return read error after restored prefix", func(t *testing.T) {
+		// the body fails only once, so the error must not get lost
+		var failed bool
+		body := io.NopCloser(io.MultiReader(strings.NewReader("{"), readerFunc(func(p []byte) (int, error) {
+			if failed {
+				return 0, io.EOF
+			}
+			failed = true
+			return 0, syscall.ECONNRESET
+		})))
+		resp := &http.Response{StatusCode: 200, Body: body}
+
+		check.False(shouldRetryBody(RetryOnJSONField("error"), 1024, resp))
+
+		data, err := io.ReadAll(resp.Body)
+		check.Equal("{", string(data))
+		check.ErrorIs(err, syscall.ECONNRESET)
+	})
+}
+
+type readerFunc func(p []byte) (int, error)
+
+func (f readerFunc) Read(p []byte) (int, error) {
+	return f(p)
+}
@@ -2,9 +2,13 @@ package httpretry
 
 import (
 	"crypto/x509"
+	"errors"
+	"fmt"
 	"github.com/stretchr/testify/assert"
+	"net"
 	"net/http"
 	"net/url"
+	"syscall"
 	"testing"
 )
 
@@ -83,9 +87,116 @@ func TestDefaultRetryPolicy(t *testing.T) {
 
 	for _, test := range tests {
 		t.Run(test.Description, func(t *testing.T) {
-			shouldRetry := defaultRetryPolicy(test.StatusCodeIn, test.ErrorIn)
+			shouldRetry := DefaultRetryPolicy(test.StatusCodeIn, test.ErrorIn)
 			check.Equal(test.Expect, shouldRetry)
 		})
 	}
 
 }
+
+func TestRetryPolicyBuildingBlocks(t *testing.T) {
+	check := assert.New(t)
+
+	certError := &url.Error{Op: "Get", URL: "https://some-non-existing-url.com", Err: x509.UnknownAuthorityError{}}
+	connectionError := &url.Error{Op: "Get", URL: "https://some-non-existing-url.com", Err: errors.New("connection refused")}
+
+	t.Run("RetryOnStatus should only retry on provided status codes", func(t *testing.T) {
+		policy := RetryOnStatus(http.StatusTeapot, http.StatusBadGateway)
+
+		check.True(policy(http.StatusTeapot, nil))
+		check.True(policy(http.StatusBadGateway, nil))
+		check.False(policy(http.StatusOK, nil))
+		check.False(policy(http.StatusServiceUnavailable, nil))
+		check.False(policy(http.StatusTeapot, connectionError))
+	})
+
+	t.Run("RetryOnTemporaryErrors should only retry on temporary errors", func(t *testing.T) {
+		check.True(RetryOnTemporaryErrors(0, &MyTemporaryError{IsTemp: true}))
+		check.False(RetryOnTemporaryErrors(0, &MyTemporaryError{IsTemp: false}))
+		check.False(RetryOnTemporaryErrors(0, connectionError))
+		check.False(RetryOnTemporaryErrors(http.StatusBadGateway, nil))
+	})
+
+	t.Run("RetryOnConnectionErrors should retry if no response was received", func(t *testing.T) {
+		check.True(RetryOnConnectionErrors(0, connectionError))
+		check.True(RetryOnConnectionErrors(0, errors.New("some error")))
+		check.True(RetryOnConnectionErrors(0, nil))
+		check.False(RetryOnConnectionErrors(http.StatusBadGateway, nil))
+		check.False(RetryOnConnectionErrors(0, &url.Error{Op: "parse", Err: errors.New("invalid")}))
+		check.False(RetryOnConnectionErrors(0, &url.Error{Op: "Get", Err: &TooManyRedirectsError{MaxRedirects: 10}}))
+		check.False(RetryOnConnectionErrors(0, &InvalidRequestError{URL: "/path", Reason: "missing host"}))
+	})
+
+	t.Run("NeverRetryCertErrors should veto certificate errors", func(t *testing.T) {
+		check.False(NeverRetryCertErrors(0, certError))
+		check.True(NeverRetryCertErrors(0, connectionError))
+		check.True(NeverRetryCertErrors(http.StatusOK, nil))
+	})
+
+	t.Run("Any should retry if one policy retries", func(t *testing.T) {
+		policy := Any(RetryOnStatus(http.StatusTeapot), RetryOnStatus(http.StatusBadGateway))
+
+		check.True(policy(http.StatusTeapot, nil))
+		check.True(policy(http.StatusBadGateway, nil))
+		check.False(policy(http.StatusOK, nil))
+		check.False(Any()(0, nil))
+	})
+
+	t.Run("All should retry if all policies retry", func(t *testing.T) {
+		policy := All(NeverRetryCertErrors, RetryOnConnectionErrors)
+
+		check.True(policy(0, connectionError))
+		check.False(policy(0, certError))
+		check.False(policy(http.StatusOK, nil))
+		check.False(All()(0, nil))
+	})
+
+	t.Run("Not should invert policy", func(t *testing.T) {
+		policy := Not(RetryOnStatus(http.StatusOK))
+
+		check.False(policy(http.StatusOK, nil))
+		check.True(policy(http.StatusTeapot, nil))
+	})
+
+	t.Run("Except should filter exceptions", func(t *testing.T) {
+		policy := Except(DefaultRetryPolicy, RetryOnStatus(http.StatusConflict))
+
+		check.False(policy(http.StatusConflict, nil))
+		check.True(policy(http.StatusBadGateway, nil))
+		check.False(policy(http.StatusOK, nil))
+	})
+
+	t.Run("DefaultRetryPolicy can be extended by additional status codes", func(t *testing.T) {
+		policy := Any(DefaultRetryPolicy, RetryOnStatus(http.StatusTeapot))
+
+		check.True(policy(http.StatusTeapot, nil))
+		check.True(policy(http.StatusBadGateway, nil))
+		check.False(policy(0, certError))
+	})
+}
+
+func TestDefaultRetryPolicyWrappedErrors(t *testing.T) {
+	check := assert.New(t)
+
+	t.Run("should not retry on wrapped certificate error", func(t *testing.T) {
+		err := &url.Error{Op: "Get", URL: "https://x", Err: fmt.Errorf("tls: %w", x509.HostnameError{})}
+		check.False(DefaultRetryPolicy(0, err))
+	})
+
+	t.Run("should not retry on unknown host", func(t *testing.T) {
+		err := &url.Error{Op: "Get", URL: "https://x", Err: &net.OpError{Op: "dial", Err: &net.DNSError{IsNotFound: true}}}
+		check.False(DefaultRetryPolicy(0, err))
+	})
+
+	t.Run("should retry on connection reset", func(t *testing.T) {
+		err := &url.Error{Op: "Get", URL: "https://x", Err: &net.OpError{Op: "read", Err: syscall.ECONNRESET}}
+		check.True(DefaultRetryPolicy(0, err))
+	})
+
+	t.Run("should retry on classified error classes", func(t *testing.T) {
+		policy := RetryOnErrorClasses(ErrorClassDNSNotFound)
+		err := &url.Error{Op: "Get", URL: "https://x", Err: &net.DNSError{IsNotFound: true}}
+		check.True(policy(0, err))
+		check.False(policy(0, nil))
+	})
+}
@@ -1,12 +1,30 @@
 package httpretry
 
 import (
-	"bytes"
+	"context"
+	"errors"
 	"io"
 	"net/http"
+	"net/url"
+	"strings"
+	"sync"
 	"time"
 )
 
+// PrepareAttemptFunc is called before every attempt with a fresh clone of the original request.
+//
+// It may modify the request (e.g. refresh an auth token, re-sign the request or set the current date header).
+// The attemptCount starts with 1 for the first attempt. If an error is returned, the request is aborted with this error.
+type PrepareAttemptFunc func(req *http.Request, attemptCount int) error
+
+// ErrMaxElapsedTime is returned if the pause gate or the rate limiter would delay a retry beyond the MaxElapsedTime,
+// although they did not when the previous response was discarded (e.g. another request extended the pause).
+// Usually the last response is returned instead.
+var ErrMaxElapsedTime = errors.New("max elapsed time exceeded while waiting to retry")
+
+// errWaitDeadline is returned by the waits of the pause gate and the rate limiter, if they would exceed the deadline
+var errWaitDeadline = errors.New("wait would exceed the deadline")
+
 // RetryRoundtripper is the roundtripper that will wrap around the actual http.Transport roundtripper
 // to enrich the http client with retry functionality.
 type RetryRoundtripper struct {
@@ -14,62 +32,294 @@ type RetryRoundtripper struct {
 	MaxRetryCount    int
 	ShouldRetry      RetryPolicy
 	CalculateBackoff BackoffPolicy
+
+	// CalculateResponseBackoff takes precedence over CalculateBackoff if set
+	CalculateResponseBackoff ResponseBackoffPolicy
+
+	// ShouldRetryBody is consulted with the first BodyPeekLimit bytes of the response body,
+	// if ShouldRetry decided not to retry (optional)
+	ShouldRetryBody BodyRetryPolicy
+	BodyPeekLimit   int64
+
+	// RateLimiter gates every attempt, including retries (optional)
+	RateLimiter *RateLimiter
+
+	// ConcurrencyLimiter limits the in-flight attempts per host (optional)
+	ConcurrencyLimiter *ConcurrencyLimiter
+
+	// PauseGate delays all attempts to a host while the host requested a pause (optional)
+	PauseGate *PauseGate
+
+	// RetryableMethods restricts retries to the given request methods, all methods are retried if empty (optional)
+	RetryableMethods []string
+
+	// AttemptTimeout limits the time of a single attempt until the response headers were received (optional)
+	AttemptTimeout time.Duration
+
+	// MaxElapsedTime stops retrying once the time since the first attempt plus the next backoff (including the waits
+	// for the PauseGate and the RateLimiter) exceeds it (optional)
+	MaxElapsedTime time.Duration
+
+	// MaxBufferedBodySize limits the size of request bodies without GetBody that are buffered to be replayed,
+	// larger bodies and bodies of unknown length are sent once without retries (optional)
+	MaxBufferedBodySize int64
+
+	// PrepareAttempt is called with a fresh clone of the request before every attempt (optional)
+	PrepareAttempt PrepareAttemptFunc
+
+	// TokenAuth authorizes every attempt and replays a request once with a refreshed token on 401 (optional)
+	TokenAuth *TokenAuth
+
+	// FollowRedirects lets the retry roundtripper follow up to MaxRedirects redirects (checked by CheckRedirect),
+	// so an attempt covers the whole redirect chain (optional)
+	FollowRedirects bool
+	MaxRedirects    int
+	CheckRedirect   RedirectPolicy
+
+	// BodyReadMode defines how failures while reading the response body are handled (optional)
+	BodyReadMode    BodyReadMode
+	BodyBufferLimit int64
+
+	// DrainBody discards responses that are not needed anymore, e.g. before a retry (optional)
+	DrainBody DrainStrategy
+
+	// CaptureFailedAttempts captures a snapshot of every discarded attempt, with up to FailedAttemptBodyLimit bytes
+	// of the body, and passes it to OnFailedAttempt (optional)
+	CaptureFailedAttempts  bool
+	FailedAttemptBodyLimit int64
+	OnFailedAttempt        FailedAttemptFunc
+
+	// AttemptHeader is set on every attempt with the value of FormatAttemptHeader (optional)
+	AttemptHeader       string
+	FormatAttemptHeader AttemptHeaderFormatter
+
+	// Labels describe the policies in Describe() instead of their function names (optional)
+	Labels PolicyLabels
+
+	// labeledFuncs are the code pointers of the policies that were labeled with WithPolicyLabels
+	labeledFuncs [numPolicyLabels]uintptr
+
+	// hostOptions are applied on top of the configuration for requests to the given host
+	hostOptions map[string][]Option
+
+	// mu guards the configuration against concurrent updates with Update()
+	mu sync.RWMutex
 }
 
 // RoundTrip implements the actual roundtripper interface (http.RoundTripper).
+//
+// Requests without scheme or host (and with a scheme other than http or https, if Next is an *http.Transport)
+// are never passed to Next, an *InvalidRequestError is returned instead.
 func (r *RetryRoundtripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	r.mu.RLock()
+	next := r.Next
+	r.mu.RUnlock()
+
+	if err := validateRequestURL(req, next); err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+
+	if next, ok := r.passThrough(req); ok {
+		return next.RoundTrip(req)
+	}
+
+	config := r.snapshot()
+	if opts, ok := config.optionsForHost(req.URL); ok {
+		return config.withOptions(opts).roundTrip(req)
+	}
+	return config.roundTrip(req)
+}
+
+// Update atomically applies the options on top of the current configuration.
+//
+// It is safe to call Update while requests are in flight, they will finish with the configuration they started with.
+// Do not modify the fields of a retry roundtripper that is in use directly, since this is not synchronized.
+func (r *RetryRoundtripper) Update(opts ...Option) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	config := r.clone()
+	for _, o := range opts {
+		o(config)
+	}
+	copyConfig(r, config)
+}
+
+// snapshot returns a copy of the current configuration.
+func (r *RetryRoundtripper) snapshot() *RetryRoundtripper {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.clone()
+}
+
+// roundTrip executes the request and retries it according to the configuration.
+func (r *RetryRoundtripper) roundTrip(req *http.Request) (resp *http.Response, err error) {
 	var (
-		resp         *http.Response
-		err          error
-		dataBuffer   *bytes.Reader
+		failed       []AttemptSnapshot
 		statusCode   int
+		firstSent    time.Time
+		reauthorized bool
+		timer        *time.Timer
 		attemptCount = 1
 		maxAttempts  = r.MaxRetryCount + 1
 	)
 
+	replayable := !r.nonReplayableBody(req)
+	if !replayable || !r.isRetryableMethod(req.Method) || retriesDisabled(req.Context()) {
+		maxAttempts = 1
+	}
+
+	if r.CaptureFailedAttempts {
+		// the snapshots of the failed attempts are accessible from the final error
+		defer func() {
+			if err != nil && len(failed) > 0 {
+				err = &FailedAttemptsError{Err: err, Attempts: failed}
+			}
+		}()
+	}
+
+	var (
+		getBody       func() (io.ReadCloser, error)
+		contentLength = req.ContentLength
+		releaseBody   = func() {}
+	)
+	var bodySent bool
+	if replayable {
+		if getBody, contentLength, releaseBody, err = replayableBody(req); err != nil {
+			return nil, err
+		}
+	} else {
+		// the body is passed to Next as is, which closes it. it has to be closed, if it never got there
+		defer func() {
+			if !bodySent && req.Body != nil {
+				req.Body.Close()
+			}
+		}()
+	}
+	defer releaseBody()
+
+	// newAttempt returns a fresh clone of the request for the current attempt, the caller's request is never modified
+	newAttempt := func() (attemptReq *http.Request, token string, err error) {
+		attemptReq = req.Clone(req.Context())
+		if getBody != nil {
+			if attemptReq.Body, err = getBody(); err != nil {
+				return nil, "", err
+			}
+			attemptReq.GetBody = getBody
+			attemptReq.ContentLength = contentLength
+		}
+
+		if r.TokenAuth != nil {
+			if token, err = r.TokenAuth.authorize(attemptReq); err != nil {
+				return nil, "", err
+			}
+		}
+
+		if r.AttemptHeader != "" && r.FormatAttemptHeader != nil {
+			attemptReq.Header.Set(r.AttemptHeader, r.FormatAttemptHeader(attemptCount, firstSent))
+		}
+
+		if r.PrepareAttempt != nil {
+			if err = r.PrepareAttempt(attemptReq, attemptCount); err != nil {
+				return nil, "", err
+			}
+		}
+		return attemptReq, token, nil
+	}
+
 	for {
 		statusCode = 0
 
-		// if request provides GetBody() we use it as Body,
-		// because GetBody can be retrieved arbitrary times for retry
-		if req.GetBody != nil {
-			bodyReadCloser, _ := req.GetBody()
-			req.Body = bodyReadCloser
-		} else if req.Body != nil {
-
-			// we need to store the complete body, since we need to reset it if a retry happens
-			// but: not very efficient because:
-			// a) huge stream data size will all be buffered completely in the memory
-			//    imagine: 1GB stream data would work efficiently with io.Copy, but has to be buffered completely in memory
-			// b) unnecessary if first attempt succeeds
-			// a solution would be to at least support more types for GetBody()
-
-			// store it for the first time
-			if dataBuffer == nil {
-				data, err := io.ReadAll(req.Body)
-				req.Body.Close()
-				if err != nil {
-					return nil, err
-				}
-				dataBuffer = bytes.NewReader(data)
-				req.ContentLength = int64(dataBuffer.Len())
-				req.Body = io.NopCloser(dataBuffer)
+		// retries must not wait for the pause gate or rate limiter beyond the max elapsed time
+		var deadline time.Time
+		if r.MaxElapsedTime > 0 && attemptCount > 1 {
+			deadline = firstSent.Add(r.MaxElapsedTime)
+		}
+
+		if r.PauseGate != nil {
+			if err := r.PauseGate.wait(req, deadline); err != nil {
+				return nil, waitError(err)
+			}
+		}
+
+		if r.RateLimiter != nil {
+			if err := r.RateLimiter.wait(req, deadline); err != nil {
+				return nil, waitError(err)
+			}
+		}
+
+		if attemptCount == 1 {
+			firstSent = time.Now()
+		}
+		var (
+			attemptReq *http.Request
+			token      string
+		)
+		attemptReq, token, err = newAttempt()
+		if err != nil {
+			return nil, err
+		}
+
+		var release func(overload bool)
+		if r.ConcurrencyLimiter != nil {
+			if release, err = r.ConcurrencyLimiter.Acquire(req); err != nil {
+				return nil, err
 			}
+		}
 
-			// reset the request body
-			dataBuffer.Seek(0, io.SeekStart)
+		bodySent = true
+		resp, err = r.send(attemptReq)
+
+		// replay exactly once with a refreshed token, independent of the retry policy
+		if r.TokenAuth != nil && replayable && !reauthorized && r.TokenAuth.Rejected(resp) {
+			reauthorized = true
+			failed = r.discard(failed, attemptCount, attemptReq, resp, err)
+			if _, err = r.TokenAuth.Refresh(req.Context(), token); err == nil {
+				attemptReq, _, err = newAttempt()
+			}
+			if err != nil {
+				if release != nil {
+					release(false)
+				}
+				return nil, err
+			}
+			resp, err = r.send(attemptReq)
 		}
 
-		resp, err = r.Next.RoundTrip(req)
 		if resp != nil {
 			statusCode = resp.StatusCode
 		}
 
-		if !r.ShouldRetry(statusCode, err) {
+		if r.RateLimiter != nil {
+			r.RateLimiter.Observe(req, resp)
+		}
+		if r.PauseGate != nil {
+			r.PauseGate.Observe(req, resp)
+		}
+
+		retry := r.shouldRetry(statusCode, resp, err)
+		if !retry && err == nil && r.BodyReadMode == BodyReadBuffered {
+			// read failures of the body are handled like errors of the attempt
+			if err = bufferBody(resp, r.BodyBufferLimit); err != nil {
+				resp, statusCode = nil, 0
+				retry = r.ShouldRetry(statusCode, err)
+			}
+		}
+		if release != nil {
+			release(retry && isOverload(statusCode, err))
+		}
+		if !retry {
+			if resp != nil && err == nil && r.BodyReadMode == BodyReadResumable {
+				resp.Body = newResumableBody(r, req, resp)
+			}
 			return resp, err
 		}
 
-		backoff := r.CalculateBackoff(attemptCount)
+		backoff := r.calculateBackoff(attemptCount, resp)
 
 		// no need to wait if we do not have retries left
 		attemptCount++
@@ -77,10 +327,22 @@ func (r *RetryRoundtripper) RoundTrip(req *http.Request) (*http.Response, error)
 			break
 		}
 
+		// give up if the retry would start after the max elapsed time
+		// compared with the remaining time, since the sum overflows for huge backoffs (e.g. of a Retry-After header)
+		if r.MaxElapsedTime > 0 && r.nextAttemptDelay(req, backoff) > r.MaxElapsedTime-time.Since(firstSent) {
+			break
+		}
+
 		// we won't need the response anymore, drain (up to a maximum) and close it
-		drainAndCloseBody(resp, 16384)
+		failed = r.discard(failed, attemptCount-1, attemptReq, resp, err)
 
-		timer := time.NewTimer(backoff)
+		// the timer is reused for all backoffs and stopped once the request finished
+		if timer == nil {
+			timer = time.NewTimer(backoff)
+			defer timer.Stop()
+		} else {
+			timer.Reset(backoff)
+		}
 		select {
 		case <-req.Context().Done():
 			// context was canceled, return context error
@@ -93,9 +355,204 @@ func (r *RetryRoundtripper) RoundTrip(req *http.Request) (*http.Response, error)
 	return resp, err
 }
 
-func drainAndCloseBody(resp *http.Response, maxBytes int64) {
-	if resp != nil {
-		io.CopyN(io.Discard, resp.Body, maxBytes)
-		resp.Body.Close()
+// nextAttemptDelay returns the time until the next attempt would be sent: the backoff, or longer if the
+// pause gate or the rate limiter hold it back.
+func (r *RetryRoundtripper) nextAttemptDelay(req *http.Request, backoff time.Duration) time.Duration {
+	delay := backoff
+	if r.PauseGate != nil {
+		if pause := r.PauseGate.remainingPause(req.URL.Host); pause > delay {
+			delay = pause
+		}
+	}
+	if r.RateLimiter != nil {
+		if wait := r.RateLimiter.delay(req, time.Now().Add(delay)); wait > 0 {
+			delay = addDuration(delay, wait)
+		}
+	}
+	return delay
+}
+
+// waitError maps errWaitDeadline to ErrMaxElapsedTime.
+func waitError(err error) error {
+	if errors.Is(err, errWaitDeadline) {
+		return ErrMaxElapsedTime
+	}
+	return err
+}
+
+// replayableBody returns a function that returns a fresh copy of the request body for every attempt.
+//
+// If the request provides GetBody() it is used, because GetBody can be retrieved arbitrary times for retry.
+// Otherwise the body has to be buffered completely in memory, since we need to reset it if a retry happens.
+// The buffer is taken from a pool and every attempt reads it with its own reader, so nothing has to be seeked.
+// The body of the caller's request is closed in both cases, because it will not be sent.
+//
+// release has to be called once the request finished, getBody is nil if the request has no body.
+func replayableBody(req *http.Request) (getBody func() (io.ReadCloser, error), contentLength int64, release func(), err error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, req.ContentLength, func() {}, nil
+	}
+	defer req.Body.Close()
+
+	if req.GetBody != nil {
+		return req.GetBody, req.ContentLength, func() {}, nil
+	}
+
+	// huge stream data will be buffered completely in memory,
+	// imagine: 1GB stream data would work efficiently with io.Copy, but has to be buffered to be replayed
+	buffer, err := newBodyBuffer(req.Body, req.ContentLength)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	return buffer.getBody, int64(buffer.buf.Len()), buffer.release, nil
+}
+
+// nonReplayableBody reports if the request body is not buffered, because it has no GetBody and is larger than
+// MaxBufferedBodySize or of unknown length. Such a request is sent exactly once.
+func (r *RetryRoundtripper) nonReplayableBody(req *http.Request) bool {
+	if r.MaxBufferedBodySize <= 0 || req.GetBody != nil || req.Body == nil || req.Body == http.NoBody {
+		return false
+	}
+	// a length of 0 with a body is unknown as well
+	return req.ContentLength <= 0 || req.ContentLength > r.MaxBufferedBodySize
+}
+
+// attempt sends a single request to the next roundtripper, limited by the AttemptTimeout.
+func (r *RetryRoundtripper) attempt(req *http.Request) (*http.Response, error) {
+	if r.AttemptTimeout <= 0 {
+		return r.Next.RoundTrip(req)
+	}
+
+	// the timeout only covers the time until the response headers were received, not reading the body,
+	// so a plain cancel is used instead of a deadline that would stay on the context of the body
+	ctx, cancel := context.WithCancel(req.Context())
+	timer := time.AfterFunc(r.AttemptTimeout, cancel)
+	resp, err := r.Next.RoundTrip(req.WithContext(ctx))
+	if !timer.Stop() && req.Context().Err() == nil {
+		// the timeout fired, the response (if any) can not be read anymore
+		if resp != nil && resp.Body != nil {
+			resp.Body.Close()
+		}
+		cancel()
+		return nil, &AttemptTimeoutError{AttemptTimeout: r.AttemptTimeout, Err: err}
+	}
+	if resp == nil || resp.Body == nil {
+		cancel()
+		return resp, err
+	}
+
+	// the context must live until the body was read
+	resp.Body = &cancelOnCloseBody{ReadCloser: resp.Body, cancel: cancel}
+	return resp, err
+}
+
+// isRetryableMethod checks if requests with the given method may be retried.
+func (r *RetryRoundtripper) isRetryableMethod(method string) bool {
+	if len(r.RetryableMethods) == 0 {
+		return true
+	}
+	for _, m := range r.RetryableMethods {
+		if strings.EqualFold(m, method) {
+			return true
+		}
+	}
+	return false
+}
+
+// optionsForHost returns the options that were registered for the host of the url.
+//
+// Options registered for the host including the port take precedence.
+func (r *RetryRoundtripper) optionsForHost(u *url.URL) ([]Option, bool) {
+	if len(r.hostOptions) == 0 || u == nil {
+		return nil, false
+	}
+	if opts, ok := r.hostOptions[u.Host]; ok {
+		return opts, true
+	}
+	opts, ok := r.hostOptions[u.Hostname()]
+	return opts, ok
+}
+
+// withOptions returns a copy of the retry roundtripper with the options applied, without the host specific options.
+func (r *RetryRoundtripper) withOptions(opts []Option) *RetryRoundtripper {
+	c := r.clone()
+	c.hostOptions = nil
+	for _, o := range opts {
+		o(c)
+	}
+	return c
+}
+
+// clone returns a shallow copy of the configuration.
+//
+// Limiters and gates are shared between the copies.
+func (r *RetryRoundtripper) clone() *RetryRoundtripper {
+	c := &RetryRoundtripper{}
+	copyConfig(c, r)
+	return c
+}
+
+// copyConfig copies all configuration fields from src to dst.
+func copyConfig(dst *RetryRoundtripper, src *RetryRoundtripper) {
+	dst.Next = src.Next
+	dst.MaxRetryCount = src.MaxRetryCount
+	dst.ShouldRetry = src.ShouldRetry
+	dst.CalculateBackoff = src.CalculateBackoff
+	dst.CalculateResponseBackoff = src.CalculateResponseBackoff
+	dst.ShouldRetryBody = src.ShouldRetryBody
+	dst.BodyPeekLimit = src.BodyPeekLimit
+	dst.RateLimiter = src.RateLimiter
+	dst.ConcurrencyLimiter = src.ConcurrencyLimiter
+	dst.PauseGate = src.PauseGate
+	dst.RetryableMethods = src.RetryableMethods
+	dst.AttemptTimeout = src.AttemptTimeout
+	dst.MaxElapsedTime = src.MaxElapsedTime
+	dst.MaxBufferedBodySize = src.MaxBufferedBodySize
+	dst.PrepareAttempt = src.PrepareAttempt
+	dst.TokenAuth = src.TokenAuth
+	dst.FollowRedirects = src.FollowRedirects
+	dst.MaxRedirects = src.MaxRedirects
+	dst.CheckRedirect = src.CheckRedirect
+	dst.BodyReadMode = src.BodyReadMode
+	dst.BodyBufferLimit = src.BodyBufferLimit
+	dst.DrainBody = src.DrainBody
+	dst.CaptureFailedAttempts = src.CaptureFailedAttempts
+	dst.FailedAttemptBodyLimit = src.FailedAttemptBodyLimit
+	dst.OnFailedAttempt = src.OnFailedAttempt
+	dst.AttemptHeader = src.AttemptHeader
+	dst.FormatAttemptHeader = src.FormatAttemptHeader
+	dst.Labels = src.Labels
+	dst.labeledFuncs = src.labeledFuncs
+	dst.hostOptions = src.hostOptions
+}
+
+// shouldRetry decides if the request should be retried by asking the RetryPolicy and the BodyRetryPolicy.
+func (r *RetryRoundtripper) shouldRetry(statusCode int, resp *http.Response, err error) bool {
+	if r.ShouldRetry(statusCode, err) {
+		return true
+	}
+	if r.ShouldRetryBody != nil && err == nil {
+		return shouldRetryBody(r.ShouldRetryBody, r.BodyPeekLimit, resp)
+	}
+	return false
+}
+
+// calculateBackoff returns the time to wait before the next attempt.
+func (r *RetryRoundtripper) calculateBackoff(attemptCount int, resp *http.Response) time.Duration {
+	if r.CalculateResponseBackoff != nil {
+		return r.CalculateResponseBackoff(attemptCount, resp)
 	}
+	return r.CalculateBackoff(attemptCount)
+}
+
+// cancelOnCloseBody cancels the attempt context when the body is closed.
+type cancelOnCloseBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnCloseBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
 }
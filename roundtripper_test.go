@@ -3,10 +3,13 @@ package httpretry
 import (
 	"bytes"
 	"context"
+	"errors"
 	"github.com/stretchr/testify/assert"
 	"io"
 	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
@@ -114,6 +117,173 @@ func TestRetryRoundtripperSimple(t *testing.T) {
 	})
 }
 
+func TestRetryRoundtripperResponseBackoff(t *testing.T) {
+	check := assert.New(t)
+
+	mockRoundtripper := &MockRoundtripper{}
+	mockBackoffPolicy := &MockBackoffPolicy{}
+	mockRetryPolicy := &MockRetryPolicy{}
+
+	var receivedStatusCodes []int
+	retryRoundtripper := RetryRoundtripper{
+		MaxRetryCount:    3,
+		Next:             mockRoundtripper,
+		ShouldRetry:      mockRetryPolicy.ShouldRetry,
+		CalculateBackoff: mockBackoffPolicy.CalculateBackoff,
+		CalculateResponseBackoff: func(attemptCount int, resp *http.Response) time.Duration {
+			receivedStatusCodes = append(receivedStatusCodes, resp.StatusCode)
+			return 1 * time.Millisecond
+		},
+	}
+
+	t.Run("should prefer response backoff policy", func(t *testing.T) {
+		mockRoundtripper.RoundTripFunc = func(req *http.Request, called int) (response *http.Response, e error) {
+			switch called {
+			case 1:
+				return FakeResponse(req, 500, []byte("error")), nil
+			default:
+				return FakeResponse(req, 200, []byte("ok")), nil
+			}
+		}
+
+		req, _ := http.NewRequest("GET", "https://my-super-nonexisting-url.asd", nil)
+		res, err := retryRoundtripper.RoundTrip(req)
+
+		check.NoError(err)
+		check.Equal(200, res.StatusCode)
+		check.Equal(0, mockBackoffPolicy.CallCount)
+		check.Equal([]int{500}, receivedStatusCodes)
+	})
+}
+
+func TestRetryRoundtripperPrepareAttempt(t *testing.T) {
+	check := assert.New(t)
+
+	mockRoundtripper := &MockRoundtripper{}
+
+	retryRoundtripper := RetryRoundtripper{
+		MaxRetryCount:    3,
+		Next:             mockRoundtripper,
+		ShouldRetry:      (&MockRetryPolicy{}).ShouldRetry,
+		CalculateBackoff: (&MockBackoffPolicy{}).CalculateBackoff,
+	}
+
+	t.Run("should prepare a fresh clone for every attempt", func(t *testing.T) {
+		var sentRequests []*http.Request
+		mockRoundtripper.RoundTripFunc = func(req *http.Request, called int) (response *http.Response, e error) {
+			sentRequests = append(sentRequests, req)
+			check.True(readerContains(t, req.Body, "body"))
+			switch called {
+			case 3:
+				return FakeResponse(req, 200, []byte("ok")), nil
+			default:
+				return FakeResponse(req, 500, []byte("error")), nil
+			}
+		}
+		retryRoundtripper.PrepareAttempt = func(req *http.Request, attemptCount int) error {
+			check.Empty(req.Header.Get("X-Attempt"), "should not see modifications of previous attempts")
+			req.Header.Set("X-Attempt", strconv.Itoa(attemptCount))
+			return nil
+		}
+
+		req, _ := http.NewRequest("POST", "https://my-super-nonexisting-url.asd", strings.NewReader("body"))
+		res, err := retryRoundtripper.RoundTrip(req)
+
+		check.NoError(err)
+		check.Equal(200, res.StatusCode)
+		check.Len(sentRequests, 3)
+		for i, sent := range sentRequests {
+			check.NotSame(req, sent)
+			check.Equal(strconv.Itoa(i+1), sent.Header.Get("X-Attempt"))
+		}
+		check.Empty(req.Header.Get("X-Attempt"))
+	})
+
+	t.Run("should abort if attempt was rejected", func(t *testing.T) {
+		mockRoundtripper.reset()
+		mockRoundtripper.RoundTripFunc = func(req *http.Request, called int) (response *http.Response, e error) {
+			return FakeResponse(req, 500, []byte("error")), nil
+		}
+		retryRoundtripper.PrepareAttempt = func(req *http.Request, attemptCount int) error {
+			if attemptCount == 2 {
+				return errors.New("token expired")
+			}
+			return nil
+		}
+
+		req, _ := http.NewRequest("GET", "https://my-super-nonexisting-url.asd", nil)
+		res, err := retryRoundtripper.RoundTrip(req)
+
+		check.Nil(res)
+		check.EqualError(err, "token expired")
+		check.Equal(1, mockRoundtripper.CallCount)
+	})
+}
+
+func TestRetryRoundtripperAttemptHeader(t *testing.T) {
+	check := assert.New(t)
+
+	mockRoundtripper := &MockRoundtripper{}
+
+	retryRoundtripper := RetryRoundtripper{
+		MaxRetryCount:    3,
+		Next:             mockRoundtripper,
+		ShouldRetry:      (&MockRetryPolicy{}).ShouldRetry,
+		CalculateBackoff: (&MockBackoffPolicy{}).CalculateBackoff,
+	}
+
+	var sentHeaders []string
+	mockRoundtripper.RoundTripFunc = func(req *http.Request, called int) (response *http.Response, e error) {
+		sentHeaders = append(sentHeaders, req.Header.Get(retryRoundtripper.AttemptHeader))
+		switch called {
+		case 3:
+			return FakeResponse(req, 200, []byte("ok")), nil
+		default:
+			return FakeResponse(req, 500, []byte("error")), nil
+		}
+	}
+
+	t.Run("should set retry count on every attempt", func(t *testing.T) {
+		mockRoundtripper.CallCount = 0
+		sentHeaders = nil
+		WithAttemptHeader("", nil)(&retryRoundtripper)
+
+		req, _ := http.NewRequest("GET", "https://my-super-nonexisting-url.asd", nil)
+		res, err := retryRoundtripper.RoundTrip(req)
+
+		check.NoError(err)
+		check.Equal(200, res.StatusCode)
+		check.Equal(DefaultAttemptHeader, retryRoundtripper.AttemptHeader)
+		check.Equal([]string{"0", "1", "2"}, sentHeaders)
+		check.Empty(req.Header.Get(DefaultAttemptHeader))
+	})
+
+	t.Run("should use custom header and formatter", func(t *testing.T) {
+		mockRoundtripper.CallCount = 0
+		sentHeaders = nil
+		var sentTimes []time.Time
+		WithAttemptHeader("Retry-Attempt", func(attemptCount int, firstSent time.Time) string {
+			sentTimes = append(sentTimes, firstSent)
+			return FormatAttemptCount(attemptCount, firstSent)
+		})(&retryRoundtripper)
+
+		req, _ := http.NewRequest("GET", "https://my-super-nonexisting-url.asd", nil)
+		_, err := retryRoundtripper.RoundTrip(req)
+
+		check.NoError(err)
+		check.Equal([]string{"1", "2", "3"}, sentHeaders)
+		check.Len(sentTimes, 3)
+		check.False(sentTimes[0].IsZero())
+		check.Equal(sentTimes[0], sentTimes[2], "should report the time of the first attempt")
+		check.Empty(req.Header.Get("Retry-Attempt"))
+	})
+
+	t.Run("should format attempt with timestamp", func(t *testing.T) {
+		sent := time.Date(2020, 1, 2, 3, 4, 5, 0, time.FixedZone("CET", 3600))
+		check.Equal("attempt=2; sent=2020-01-02T02:04:05Z", FormatAttemptWithTimestamp(2, sent))
+	})
+}
+
 func TestRetryRoundtripperWithBody(t *testing.T) {
 	check := assert.New(t)
 
@@ -191,6 +361,144 @@ func TestRetryRoundtripperWithBody(t *testing.T) {
 		check.True(readerContains(t, res.Body, "ok"))
 		check.NoError(err)
 	})
+
+	t.Run("should send non-replayable body exactly once", func(t *testing.T) {
+		reset()
+		retryRoundtripper.MaxBufferedBodySize = 2
+		defer func() { retryRoundtripper.MaxBufferedBodySize = 0 }()
+		// the attempt header disables the fast path, so the body is sent by the retry loop
+		retryRoundtripper.AttemptHeader = "X-Attempt"
+		retryRoundtripper.FormatAttemptHeader = FormatRetryCount
+		defer func() { retryRoundtripper.AttemptHeader, retryRoundtripper.FormatAttemptHeader = "", nil }()
+
+		for _, body := range []io.Reader{bytes.NewBufferString("body"), io.NopCloser(strings.NewReader("body"))} {
+			mockRoundtripper.reset()
+			mockRoundtripper.RoundTripFunc = func(req *http.Request, called int) (response *http.Response, e error) {
+				readerContains(t, req.Body, "body")
+				return FakeResponse(req, 500, []byte("error")), nil
+			}
+			req, _ := http.NewRequest("POST", "https://my-super-nonexisting-url.asd", body)
+			req.GetBody = nil
+			res, err := retryRoundtripper.RoundTrip(req)
+
+			check.NoError(err)
+			check.Equal(500, res.StatusCode)
+			check.Equal(1, mockRoundtripper.CallCount)
+		}
+	})
+
+	t.Run("should close non-replayable body if it was not sent", func(t *testing.T) {
+		failingPrepare := RetryRoundtripper{
+			MaxRetryCount:       3,
+			Next:                mockRoundtripper,
+			ShouldRetry:         mockRetryPolicy.ShouldRetry,
+			CalculateBackoff:    mockBackoffPolicy.CalculateBackoff,
+			MaxBufferedBodySize: 2,
+			PrepareAttempt: func(req *http.Request, attemptCount int) error {
+				return errors.New("prepare failed")
+			},
+		}
+		pauseGate := NewPauseGate(0, 0)
+		pauseGate.pausedUntil["my-super-nonexisting-url.asd"] = time.Now().Add(time.Hour)
+		paused := RetryRoundtripper{
+			MaxRetryCount:       3,
+			Next:                mockRoundtripper,
+			ShouldRetry:         mockRetryPolicy.ShouldRetry,
+			CalculateBackoff:    mockBackoffPolicy.CalculateBackoff,
+			MaxBufferedBodySize: 2,
+			PauseGate:           pauseGate,
+		}
+
+		for _, rt := range []*RetryRoundtripper{&failingPrepare, &paused} {
+			mockRoundtripper.reset()
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+			body := newTrackingBody(4, false)
+			req, _ := http.NewRequestWithContext(ctx, "POST", "https://my-super-nonexisting-url.asd", body)
+			_, err := rt.RoundTrip(req)
+			cancel()
+
+			check.Error(err)
+			check.Equal(0, mockRoundtripper.CallCount)
+			check.True(body.isClosed())
+		}
+	})
+}
+
+func TestRetryRoundtripperDoesNotModifyRequest(t *testing.T) {
+	check := assert.New(t)
+
+	mockRoundtripper := &MockRoundtripper{}
+
+	retryRoundtripper := RetryRoundtripper{
+		MaxRetryCount:    3,
+		Next:             mockRoundtripper,
+		ShouldRetry:      (&MockRetryPolicy{}).ShouldRetry,
+		CalculateBackoff: (&MockBackoffPolicy{}).CalculateBackoff,
+		PrepareAttempt: func(req *http.Request, attemptCount int) error {
+			req.Header.Set("X-Attempt", strconv.Itoa(attemptCount))
+			return nil
+		},
+	}
+
+	var receivedBodies []string
+	mockRoundtripper.RoundTripFunc = func(req *http.Request, called int) (response *http.Response, e error) {
+		data, _ := io.ReadAll(req.Body)
+		receivedBodies = append(receivedBodies, string(data))
+		check.Equal(int64(4), req.ContentLength)
+		switch called % 2 {
+		case 0:
+			return FakeResponse(req, 200, []byte("ok")), nil
+		default:
+			return FakeResponse(req, 500, []byte("error")), nil
+		}
+	}
+
+	t.Run("should not modify request with GetBody", func(t *testing.T) {
+		mockRoundtripper.CallCount = 0
+		receivedBodies = nil
+
+		req, _ := http.NewRequest("POST", "https://my-super-nonexisting-url.asd", strings.NewReader("body"))
+		body, getBody, header := req.Body, req.GetBody, req.Header
+
+		_, err := retryRoundtripper.RoundTrip(req)
+		check.NoError(err)
+
+		check.Equal(body, req.Body)
+		check.Equal(header, req.Header)
+		check.Empty(req.Header.Get("X-Attempt"))
+		check.Equal(int64(4), req.ContentLength)
+		check.NotNil(getBody)
+		check.NotNil(req.GetBody)
+
+		// reuse the request
+		_, err = retryRoundtripper.RoundTrip(req)
+		check.NoError(err)
+
+		check.Equal([]string{"body", "body", "body", "body"}, receivedBodies)
+		check.Equal(body, req.Body)
+	})
+
+	t.Run("should not modify request with buffered body", func(t *testing.T) {
+		mockRoundtripper.CallCount = 0
+		receivedBodies = nil
+
+		r, w := io.Pipe()
+		go func() {
+			w.Write([]byte("body"))
+			w.Close()
+		}()
+		req, _ := http.NewRequest("POST", "https://my-super-nonexisting-url.asd", r)
+		req.ContentLength = 4
+		body := req.Body
+
+		_, err := retryRoundtripper.RoundTrip(req)
+		check.NoError(err)
+
+		check.Equal(body, req.Body)
+		check.Nil(req.GetBody)
+		check.Empty(req.Header.Get("X-Attempt"))
+		check.Equal([]string{"body", "body"}, receivedBodies)
+	})
 }
 
 func readerContains(t *testing.T, r io.Reader, substring string) bool {
@@ -221,6 +529,13 @@ func (f *MockRoundtripper) RoundTrip(req *http.Request) (*http.Response, error)
 	return FakeResponse(req, 200, []byte("OK")), nil
 }
 
+// roundTripperFunc implements http.RoundTripper with a function
+type roundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
 type MockBackoffPolicy struct {
 	CallCount   int
 	BackoffFunc func(attempt int) time.Duration
@@ -284,3 +599,413 @@ func FakeResponse(req *http.Request, code int, body []byte) *http.Response {
 		Request:       req,
 	}
 }
+
+// newBenchmarkRoundtripper returns a retry roundtripper whose next roundtripper reads the request body and fails
+// the first failures attempts of every request with 500.
+func newBenchmarkRoundtripper(failures int) *RetryRoundtripper {
+	attempts := 0
+	return newRetryRoundtripper(roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if req.Body != nil {
+			io.Copy(io.Discard, req.Body)
+			req.Body.Close()
+		}
+
+		attempts++
+		statusCode := http.StatusOK
+		if attempts <= failures {
+			statusCode = http.StatusInternalServerError
+		} else {
+			attempts = 0
+		}
+		return &http.Response{StatusCode: statusCode, Body: http.NoBody, Request: req}, nil
+	}), WithBackoffPolicy(ConstantBackoff(0, 0)))
+}
+
+func BenchmarkRoundTripperSuccess(b *testing.B) {
+	retryRoundtripper := newBenchmarkRoundtripper(0)
+	req, _ := http.NewRequest("GET", "https://my-super-nonexisting-url.asd", nil)
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		resp, err := retryRoundtripper.RoundTrip(req)
+		if err != nil || resp.StatusCode != http.StatusOK {
+			b.Fatal(resp, err)
+		}
+	}
+}
+
+func BenchmarkRoundTripperRetry(b *testing.B) {
+	retryRoundtripper := newBenchmarkRoundtripper(2)
+	req, _ := http.NewRequest("GET", "https://my-super-nonexisting-url.asd", nil)
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		resp, err := retryRoundtripper.RoundTrip(req)
+		if err != nil || resp.StatusCode != http.StatusOK {
+			b.Fatal(resp, err)
+		}
+	}
+}
+
+func BenchmarkRoundTripperLargeBody(b *testing.B) {
+	body := bytes.Repeat([]byte("x"), 1<<20)
+
+	for _, failures := range []int{0, 2} {
+		retryRoundtripper := newBenchmarkRoundtripper(failures)
+
+		b.Run("buffered "+strconv.Itoa(failures)+" retries", func(b *testing.B) {
+			b.SetBytes(int64(len(body)))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				// a body without GetBody has to be buffered
+				req, _ := http.NewRequest("POST", "https://my-super-nonexisting-url.asd", io.NopCloser(bytes.NewReader(body)))
+				resp, err := retryRoundtripper.RoundTrip(req)
+				if err != nil || resp.StatusCode != http.StatusOK {
+					b.Fatal(resp, err)
+				}
+			}
+		})
+
+		b.Run("GetBody "+strconv.Itoa(failures)+" retries", func(b *testing.B) {
+			b.SetBytes(int64(len(body)))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				req, _ := http.NewRequest("POST", "https://my-super-nonexisting-url.asd", bytes.NewReader(body))
+				resp, err := retryRoundtripper.RoundTrip(req)
+				if err != nil || resp.StatusCode != http.StatusOK {
+					b.Fatal(resp, err)
+				}
+			}
+		})
+	}
+}
+
+func TestRetryRoundtripperPassThrough(t *testing.T) {
+	check := assert.New(t)
+
+	var sent *http.Request
+	next := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		sent = req
+		return &http.Response{StatusCode: http.StatusInternalServerError, Body: http.NoBody, Request: req}, nil
+	})
+
+	tests := []struct {
+		name        string
+		opts        []Option
+		ctx         context.Context
+		passThrough bool
+	}{
+		{name: "max retry count 0", opts: []Option{WithMaxRetryCount(0)}, passThrough: true},
+		{name: "retries disabled", ctx: DisableRetries(context.Background()), passThrough: true},
+		{name: "method not retryable", opts: []Option{WithRetryableMethods("GET")}, passThrough: true},
+		{name: "non-replayable body", opts: []Option{WithMaxBufferedBodySize(1 << 10)}, passThrough: true},
+		{name: "retries possible"},
+		{name: "attempt header", opts: []Option{WithMaxRetryCount(0), WithAttemptHeader("", nil)}},
+		{name: "host options", opts: []Option{WithMaxRetryCount(0), WithHostOptions("my-super-nonexisting-url.asd")}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := tt.ctx
+			if ctx == nil {
+				ctx = context.Background()
+			}
+			req, _ := http.NewRequestWithContext(ctx, "POST", "https://my-super-nonexisting-url.asd", io.NopCloser(strings.NewReader("body")))
+
+			retryRoundtripper := newRetryRoundtripper(next, append(tt.opts, WithBackoffPolicy(ConstantBackoff(0, 0)))...)
+			res, err := retryRoundtripper.RoundTrip(req)
+
+			check.NoError(err)
+			check.Equal(500, res.StatusCode)
+			check.Equal(tt.passThrough, sent == req, "request should only be passed through unmodified on the fast path")
+		})
+	}
+}
+
+// BenchmarkRoundTripperPassThrough compares the retry roundtripper on the fast path with the bare next roundtripper.
+func BenchmarkRoundTripperPassThrough(b *testing.B) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	transport := &http.Transport{}
+	defer transport.CloseIdleConnections()
+
+	stub := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody, Request: req}, nil
+	})
+
+	for _, next := range []struct {
+		name string
+		rt   http.RoundTripper
+		url  string
+	}{
+		{name: "stub", rt: stub, url: "https://my-super-nonexisting-url.asd"},
+		{name: "transport", rt: transport, url: server.URL},
+	} {
+		roundtrippers := []struct {
+			name string
+			rt   http.RoundTripper
+			ctx  context.Context
+		}{
+			{name: "bare", rt: next.rt, ctx: context.Background()},
+			{name: "max retry count 0", rt: newRetryRoundtripper(next.rt, WithMaxRetryCount(0)), ctx: context.Background()},
+			{name: "retries disabled", rt: newRetryRoundtripper(next.rt), ctx: DisableRetries(context.Background())},
+			{name: "non-replayable body", rt: newRetryRoundtripper(next.rt, WithMaxBufferedBodySize(1<<10)), ctx: context.Background()},
+			{name: "retries possible", rt: newRetryRoundtripper(next.rt), ctx: context.Background()},
+		}
+
+		for _, rt := range roundtrippers {
+			b.Run(next.name+" "+rt.name, func(b *testing.B) {
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					req, _ := http.NewRequestWithContext(rt.ctx, "POST", next.url, io.NopCloser(strings.NewReader("body")))
+					resp, err := rt.rt.RoundTrip(req)
+					if err != nil {
+						b.Fatal(err)
+					}
+					io.Copy(io.Discard, resp.Body)
+					resp.Body.Close()
+				}
+			})
+		}
+	}
+}
+
+func TestRetryRoundtripperMaxElapsedTime(t *testing.T) {
+	check := assert.New(t)
+
+	mockRoundtripper := &MockRoundtripper{}
+	mockRoundtripper.RoundTripFunc = func(req *http.Request, called int) (response *http.Response, e error) {
+		return FakeResponse(req, 500, []byte(strconv.Itoa(called))), nil
+	}
+
+	retryRoundtripper := RetryRoundtripper{
+		MaxRetryCount:    1000,
+		Next:             mockRoundtripper,
+		ShouldRetry:      (&MockRetryPolicy{}).ShouldRetry,
+		CalculateBackoff: ConstantBackoff(20*time.Millisecond, 0),
+	}
+	WithMaxElapsedTime(50 * time.Millisecond)(&retryRoundtripper)
+
+	t.Run("should stop retrying before max elapsed time and return last response", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "https://my-super-nonexisting-url.asd", nil)
+
+		start := time.Now()
+		res, err := retryRoundtripper.RoundTrip(req)
+
+		check.NoError(err)
+		check.Equal(500, res.StatusCode)
+		check.True(readerContains(t, res.Body, strconv.Itoa(mockRoundtripper.CallCount)), "should return the last response")
+		check.Less(time.Since(start), 500*time.Millisecond, "should not wait for all retries")
+		check.GreaterOrEqual(mockRoundtripper.CallCount, 2)
+		check.Less(mockRoundtripper.CallCount, 4)
+	})
+
+	t.Run("should not overflow with huge Retry-After backoff", func(t *testing.T) {
+		next := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			resp := FakeResponse(req, 503, []byte("unavailable"))
+			resp.Header = http.Header{"Retry-After": []string{"99999999999"}}
+			return resp, nil
+		})
+		retryRoundtripper := newRetryRoundtripper(next,
+			WithRetryPolicy(DefaultRetryPolicy),
+			WithResponseBackoffPolicy(FromRetryAfter(ConstantBackoff(0, 0))),
+			WithMaxElapsedTime(100*time.Millisecond),
+		)
+		req, _ := http.NewRequest("GET", "https://my-super-nonexisting-url.asd", nil)
+
+		done := make(chan struct{})
+		var (
+			res *http.Response
+			err error
+		)
+		go func() {
+			defer close(done)
+			res, err = retryRoundtripper.RoundTrip(req)
+		}()
+
+		select {
+		case <-done:
+			check.NoError(err)
+			check.Equal(503, res.StatusCode)
+		case <-time.After(time.Second):
+			t.Fatal("should not wait for the Retry-After backoff")
+		}
+	})
+
+	t.Run("should not wait for pause gate or rate limiter beyond max elapsed time", func(t *testing.T) {
+		next := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			resp := FakeResponse(req, http.StatusTooManyRequests, []byte("slow down"))
+			resp.Header = http.Header{"Retry-After": []string{"3600"}}
+			return resp, nil
+		})
+
+		for _, opt := range []Option{
+			WithPauseGate(NewPauseGate(0, 0)),
+			WithRateLimiter(NewRateLimiter(10, 1, nil, 0)),
+		} {
+			retryRoundtripper := newRetryRoundtripper(next,
+				WithBackoffPolicy(ConstantBackoff(0, 0)),
+				WithMaxElapsedTime(500*time.Millisecond),
+				opt,
+			)
+			ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+			req, _ := http.NewRequestWithContext(ctx, "GET", "https://my-super-nonexisting-url.asd", nil)
+
+			start := time.Now()
+			res, err := retryRoundtripper.RoundTrip(req)
+			cancel()
+
+			check.NoError(err)
+			check.Equal(http.StatusTooManyRequests, res.StatusCode)
+			check.True(readerContains(t, res.Body, "slow down"), "should return the last response")
+			check.Less(time.Since(start), 500*time.Millisecond)
+		}
+	})
+}
+
+func TestRetryRoundtripperInvalidRequestURL(t *testing.T) {
+	check := assert.New(t)
+
+	mockRoundtripper := &MockRoundtripper{}
+	retryRoundtripper := RetryRoundtripper{
+		MaxRetryCount:    3,
+		Next:             mockRoundtripper,
+		ShouldRetry:      (&MockRetryPolicy{}).ShouldRetry,
+		CalculateBackoff: (&MockBackoffPolicy{}).CalculateBackoff,
+	}
+
+	for _, rawURL := range []string{"/path", "my-super-nonexisting-url.asd/path", "https:///path"} {
+		t.Run("should not send request to "+rawURL, func(t *testing.T) {
+			mockRoundtripper.reset()
+			req, _ := http.NewRequest("GET", rawURL, nil)
+			_, err := retryRoundtripper.RoundTrip(req)
+
+			var invalidRequestErr *InvalidRequestError
+			check.True(errors.As(err, &invalidRequestErr))
+			check.Equal(ErrorClassInvalidRequest, ClassifyError(err))
+			check.Equal(0, mockRoundtripper.CallCount)
+		})
+	}
+
+	t.Run("should reject unsupported scheme of http.Transport", func(t *testing.T) {
+		transport := &http.Transport{}
+		defer transport.CloseIdleConnections()
+		retryRoundtripper := newRetryRoundtripper(transport, WithBackoffPolicy(ConstantBackoff(time.Second, 0)))
+
+		req, _ := http.NewRequest("GET", "ftp://my-super-nonexisting-url.asd/file", nil)
+		start := time.Now()
+		_, err := retryRoundtripper.RoundTrip(req)
+
+		var invalidRequestErr *InvalidRequestError
+		check.True(errors.As(err, &invalidRequestErr))
+		check.Equal(ErrorClassInvalidRequest, ClassifyError(err))
+		check.Less(time.Since(start), time.Second, "should not retry")
+	})
+
+	t.Run("should pass unknown scheme to custom roundtripper", func(t *testing.T) {
+		mockRoundtripper.reset()
+		mockRoundtripper.RoundTripFunc = func(req *http.Request, called int) (*http.Response, error) {
+			return FakeResponse(req, 200, []byte("ok")), nil
+		}
+
+		req, _ := http.NewRequest("GET", "ftp://my-super-nonexisting-url.asd/file", nil)
+		res, err := retryRoundtripper.RoundTrip(req)
+
+		check.NoError(err)
+		check.Equal(200, res.StatusCode)
+		check.Equal(1, mockRoundtripper.CallCount)
+	})
+}
+
+func TestRetryRoundtripperAttemptTimeout(t *testing.T) {
+	check := assert.New(t)
+
+	retryRoundtripper := &RetryRoundtripper{
+		MaxRetryCount:    2,
+		ShouldRetry:      DefaultRetryPolicy,
+		CalculateBackoff: ConstantBackoff(0, 0),
+		AttemptTimeout:   20 * time.Millisecond,
+	}
+
+	t.Run("should retry attempts that timed out", func(t *testing.T) {
+		calls := 0
+		retryRoundtripper.Next = roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			calls++
+			if calls == 1 {
+				<-req.Context().Done()
+				return nil, req.Context().Err()
+			}
+			return FakeResponse(req, 200, []byte("ok")), nil
+		})
+
+		req, _ := http.NewRequest("GET", "https://my-super-nonexisting-url.asd", nil)
+		res, err := retryRoundtripper.RoundTrip(req)
+
+		check.NoError(err)
+		check.Equal(2, calls)
+		check.True(readerContains(t, res.Body, "ok"))
+	})
+
+	t.Run("should keep context alive until body was closed", func(t *testing.T) {
+		var attemptCtx context.Context
+		retryRoundtripper.Next = roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			attemptCtx = req.Context()
+			return FakeResponse(req, 200, []byte("ok")), nil
+		})
+
+		req, _ := http.NewRequest("GET", "https://my-super-nonexisting-url.asd", nil)
+		res, err := retryRoundtripper.RoundTrip(req)
+
+		check.NoError(err)
+		check.NoError(attemptCtx.Err())
+		res.Body.Close()
+		check.ErrorIs(attemptCtx.Err(), context.Canceled)
+	})
+
+	t.Run("should classify timed out attempts as timeout", func(t *testing.T) {
+		retryRoundtripper.Next = roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			<-req.Context().Done()
+			return nil, req.Context().Err()
+		})
+
+		req, _ := http.NewRequest("GET", "https://my-super-nonexisting-url.asd", nil)
+		_, err := retryRoundtripper.RoundTrip(req)
+
+		var timeoutErr *AttemptTimeoutError
+		check.True(errors.As(err, &timeoutErr))
+		check.ErrorIs(err, context.DeadlineExceeded)
+		check.Equal(ErrorClassTimeout, ClassifyError(err))
+	})
+
+	t.Run("should not limit reading a slow body", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+			for i := 0; i < 3; i++ {
+				w.Write([]byte("x"))
+				w.(http.Flusher).Flush()
+				time.Sleep(50 * time.Millisecond)
+			}
+		}))
+		defer server.Close()
+
+		transport := &http.Transport{}
+		defer transport.CloseIdleConnections()
+		retryRoundtripper.Next = transport
+
+		req, _ := http.NewRequest("GET", server.URL, nil)
+		res, err := retryRoundtripper.RoundTrip(req)
+		check.NoError(err)
+
+		body, err := io.ReadAll(res.Body)
+		res.Body.Close()
+		check.NoError(err)
+		check.Equal("xxx", string(body))
+	})
+}
@@ -0,0 +1,113 @@
+package httpretry
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+)
+
+const (
+	// defaultFailedAttemptBodyLimit is the number of body bytes that are captured, if no limit is set
+	defaultFailedAttemptBodyLimit = 1024
+
+	// redacted replaces the values of sensitive headers
+	redacted = "[REDACTED]"
+)
+
+// redactedHeaders are not captured in attempt snapshots, since they contain credentials
+var redactedHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"}
+
+// AttemptSnapshot is a snapshot of a failed attempt that was discarded before the next attempt.
+type AttemptSnapshot struct {
+	// AttemptCount starts with 1 for the first attempt
+	AttemptCount int
+	URL          string
+	// StatusCode is 0 if no response was received
+	StatusCode int
+	// Header of the response, credentials are redacted
+	Header http.Header
+	// Body contains the first bytes of the response body
+	Body []byte
+	// BodyTruncated is true if the body was longer than the captured bytes
+	BodyTruncated bool
+	// Err is the error of the attempt, nil if a response was received
+	Err error
+}
+
+// FailedAttemptFunc is called with the snapshot of every failed attempt that is discarded.
+type FailedAttemptFunc func(snapshot AttemptSnapshot)
+
+// FailedAttemptsError wraps the final error of a request and contains the snapshots of the failed attempts before.
+//
+// It is returned if failed attempts are captured (see WithFailedAttemptCapture).
+type FailedAttemptsError struct {
+	Err      error
+	Attempts []AttemptSnapshot
+}
+
+func (e *FailedAttemptsError) Error() string {
+	return fmt.Sprintf("%v (after %d failed attempts)", e.Err, len(e.Attempts))
+}
+
+func (e *FailedAttemptsError) Unwrap() error {
+	return e.Err
+}
+
+// discard captures the snapshot of a failed attempt, if enabled, and drains the response.
+func (r *RetryRoundtripper) discard(failed []AttemptSnapshot, attemptCount int, req *http.Request, resp *http.Response, err error) []AttemptSnapshot {
+	if r.CaptureFailedAttempts {
+		snapshot := newAttemptSnapshot(attemptCount, req, resp, err, r.FailedAttemptBodyLimit)
+		failed = append(failed, snapshot)
+		if r.OnFailedAttempt != nil {
+			r.OnFailedAttempt(snapshot)
+		}
+	}
+	r.drainBody(resp)
+	return failed
+}
+
+// newAttemptSnapshot captures the status, the redacted headers and up to bodyLimit bytes of the response body.
+func newAttemptSnapshot(attemptCount int, req *http.Request, resp *http.Response, err error, bodyLimit int64) AttemptSnapshot {
+	snapshot := AttemptSnapshot{
+		AttemptCount: attemptCount,
+		URL:          req.URL.String(),
+		Err:          err,
+	}
+	if resp == nil {
+		return snapshot
+	}
+
+	if resp.Request != nil && resp.Request.URL != nil {
+		// the url of the last redirect
+		snapshot.URL = resp.Request.URL.String()
+	}
+	snapshot.StatusCode = resp.StatusCode
+	snapshot.Header = redactHeader(resp.Header)
+
+	if resp.Body != nil {
+		if bodyLimit <= 0 {
+			bodyLimit = defaultFailedAttemptBodyLimit
+		}
+		// one more byte is read to detect truncated bodies, the rest is discarded by the drain strategy
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, bodyLimit+1))
+		if int64(len(body)) > bodyLimit {
+			body, snapshot.BodyTruncated = body[:bodyLimit], true
+		}
+		snapshot.Body = body
+	}
+	return snapshot
+}
+
+// redactHeader returns a copy of the header with redacted credentials.
+func redactHeader(header http.Header) http.Header {
+	if header == nil {
+		return nil
+	}
+	header = header.Clone()
+	for _, name := range redactedHeaders {
+		if values := header.Values(name); len(values) > 0 {
+			header[http.CanonicalHeaderKey(name)] = []string{redacted}
+		}
+	}
+	return header
+}
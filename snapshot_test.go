@@ -0,0 +1,125 @@
+package httpretry
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestRetryRoundtripperFailedAttemptCapture(t *testing.T) {
+	check := assert.New(t)
+
+	mockRoundtripper := &MockRoundtripper{}
+
+	retryRoundtripper := RetryRoundtripper{
+		MaxRetryCount:    2,
+		Next:             mockRoundtripper,
+		ShouldRetry:      (&MockRetryPolicy{}).ShouldRetry,
+		CalculateBackoff: (&MockBackoffPolicy{}).CalculateBackoff,
+	}
+
+	var captured []AttemptSnapshot
+	WithFailedAttemptCapture(8, func(snapshot AttemptSnapshot) {
+		captured = append(captured, snapshot)
+	})(&retryRoundtripper)
+
+	t.Run("should capture redacted snapshots of failed attempts", func(t *testing.T) {
+		captured = nil
+		mockRoundtripper.reset()
+		mockRoundtripper.RoundTripFunc = func(req *http.Request, called int) (response *http.Response, e error) {
+			switch called {
+			case 1:
+				resp := FakeResponse(req, 500, []byte("internal server error"))
+				resp.Header = http.Header{
+					"Set-Cookie":   {"session=secret"},
+					"X-Request-Id": {"1"},
+				}
+				return resp, nil
+			case 2:
+				return nil, errors.New("connection reset")
+			default:
+				return FakeResponse(req, 200, []byte("ok")), nil
+			}
+		}
+
+		req, _ := http.NewRequest("GET", "https://my-super-nonexisting-url.asd", nil)
+		res, err := retryRoundtripper.RoundTrip(req)
+
+		check.NoError(err)
+		check.Equal(200, res.StatusCode)
+		check.Len(captured, 2)
+
+		check.Equal(1, captured[0].AttemptCount)
+		check.Equal(500, captured[0].StatusCode)
+		check.Equal("https://my-super-nonexisting-url.asd", captured[0].URL)
+		check.Equal("internal", string(captured[0].Body))
+		check.True(captured[0].BodyTruncated)
+		check.Equal(redacted, captured[0].Header.Get("Set-Cookie"))
+		check.Equal("1", captured[0].Header.Get("X-Request-Id"))
+		check.NoError(captured[0].Err)
+
+		check.Equal(2, captured[1].AttemptCount)
+		check.Equal(0, captured[1].StatusCode)
+		check.EqualError(captured[1].Err, "connection reset")
+	})
+
+	t.Run("should return snapshots with final error", func(t *testing.T) {
+		captured = nil
+		mockRoundtripper.reset()
+		mockRoundtripper.RoundTripFunc = func(req *http.Request, called int) (response *http.Response, e error) {
+			if called < 3 {
+				return FakeResponse(req, 500, []byte("unavailable")), nil
+			}
+			return nil, errors.New("connection refused")
+		}
+
+		req, _ := http.NewRequest("GET", "https://my-super-nonexisting-url.asd", nil)
+		res, err := retryRoundtripper.RoundTrip(req)
+
+		var failedAttemptsErr *FailedAttemptsError
+		check.Nil(res)
+		check.True(errors.As(err, &failedAttemptsErr))
+		check.EqualError(errors.Unwrap(err), "connection refused")
+		check.Equal("connection refused (after 2 failed attempts)", err.Error())
+		check.Equal(captured, failedAttemptsErr.Attempts)
+		check.Equal(500, failedAttemptsErr.Attempts[0].StatusCode)
+		check.Equal("unavail", string(failedAttemptsErr.Attempts[1].Body[:7]))
+	})
+
+	t.Run("should not wrap error without failed attempts", func(t *testing.T) {
+		mockRoundtripper.reset()
+		mockRoundtripper.RoundTripFunc = func(req *http.Request, called int) (response *http.Response, e error) {
+			return nil, errors.New("invalid request")
+		}
+
+		rt := retryRoundtripper.clone()
+		rt.ShouldRetry = func(statusCode int, err error) bool { return false }
+
+		req, _ := http.NewRequest("GET", "https://my-super-nonexisting-url.asd", nil)
+		_, err := rt.RoundTrip(req)
+
+		check.EqualError(err, "invalid request")
+	})
+}
+
+func TestRedactHeader(t *testing.T) {
+	check := assert.New(t)
+
+	header := http.Header{
+		"Authorization":       {"Bearer secret"},
+		"Proxy-Authorization": {"Basic secret"},
+		"Cookie":              {"a=1", "b=2"},
+		"Content-Type":        {"application/json"},
+	}
+	redactedHeader := redactHeader(header)
+
+	check.Equal([]string{redacted}, redactedHeader.Values("Authorization"))
+	check.Equal([]string{redacted}, redactedHeader.Values("Proxy-Authorization"))
+	check.Equal([]string{redacted}, redactedHeader.Values("Cookie"))
+	check.Empty(redactedHeader.Values("Set-Cookie"))
+	check.Equal("application/json", redactedHeader.Get("Content-Type"))
+	check.True(strings.HasPrefix(header.Get("Authorization"), "Bearer"), "should not modify the original header")
+	check.Nil(redactHeader(nil))
+}
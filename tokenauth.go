@@ -0,0 +1,134 @@
+package httpretry
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// TokenSource fetches a new access token (e.g. with an OAuth2 refresh token or client credentials grant).
+type TokenSource func(ctx context.Context) (string, error)
+
+// TokenAuth authorizes every attempt with a bearer token and refreshes the token if the server rejected it.
+//
+// If a response has the status 401 Unauthorized, the token is refreshed and the request is replayed exactly once
+// with the new token. The replay does not count as a retry and does not depend on the RetryPolicy.
+// Concurrent refreshes are single-flighted: a burst of 401s only triggers one call of the token source.
+//
+// A TokenAuth is safe for concurrent use and may be shared between multiple clients.
+type TokenAuth struct {
+	source              TokenSource
+	requireInvalidToken bool
+
+	mu     sync.Mutex
+	token  string
+	flight *tokenFlight
+}
+
+// tokenFlight is a running refresh that concurrent callers wait for.
+type tokenFlight struct {
+	done  chan struct{}
+	token string
+	err   error
+}
+
+// NewTokenAuth returns a token auth that fetches tokens from the source.
+//
+// If requireInvalidToken is true, the token is only refreshed if the 401 response has a
+// WWW-Authenticate header with error="invalid_token" (RFC 6750), e.g. to not refresh on missing permissions.
+func NewTokenAuth(source TokenSource, requireInvalidToken bool) *TokenAuth {
+	if source == nil {
+		panic("token source must not be nil")
+	}
+	return &TokenAuth{
+		source:              source,
+		requireInvalidToken: requireInvalidToken,
+	}
+}
+
+// Token returns the current token, it is fetched from the token source on first use.
+func (a *TokenAuth) Token(ctx context.Context) (string, error) {
+	a.mu.Lock()
+	token := a.token
+	a.mu.Unlock()
+
+	if token != "" {
+		return token, nil
+	}
+	return a.Refresh(ctx, "")
+}
+
+// Refresh fetches a new token to replace the rejected token.
+//
+// If the rejected token was already replaced, the current token is returned without calling the token source.
+// If a refresh is running, Refresh waits for its result instead of starting another one.
+//
+// The token source is called with a context that keeps the values of ctx, but is not canceled with it,
+// since other callers may wait for the same refresh. Every caller stops waiting when its own ctx is done.
+func (a *TokenAuth) Refresh(ctx context.Context, rejected string) (string, error) {
+	a.mu.Lock()
+	if a.token != "" && a.token != rejected {
+		token := a.token
+		a.mu.Unlock()
+		return token, nil
+	}
+
+	flight := a.flight
+	if flight == nil {
+		flight = &tokenFlight{done: make(chan struct{})}
+		a.flight = flight
+		go a.fetch(detachedContext{parent: ctx}, flight)
+	}
+	a.mu.Unlock()
+
+	select {
+	case <-ctx.Done():
+		return "", ctx.Err()
+	case <-flight.done:
+		return flight.token, flight.err
+	}
+}
+
+// fetch calls the token source for the flight and publishes the result to all waiting callers.
+func (a *TokenAuth) fetch(ctx context.Context, flight *tokenFlight) {
+	token, err := a.source(ctx)
+
+	a.mu.Lock()
+	flight.token, flight.err = token, err
+	if err == nil {
+		a.token = token
+	}
+	a.flight = nil
+	a.mu.Unlock()
+	close(flight.done)
+}
+
+// Rejected checks if the response rejected the token of the request.
+func (a *TokenAuth) Rejected(resp *http.Response) bool {
+	if resp == nil || resp.StatusCode != http.StatusUnauthorized {
+		return false
+	}
+	return !a.requireInvalidToken || isInvalidTokenChallenge(resp.Header)
+}
+
+// authorize sets the current token on the request and returns it.
+func (a *TokenAuth) authorize(req *http.Request) (string, error) {
+	token, err := a.Token(req.Context())
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	return token, nil
+}
+
+// isInvalidTokenChallenge checks if a WWW-Authenticate header contains the error "invalid_token".
+func isInvalidTokenChallenge(header http.Header) bool {
+	for _, challenge := range header.Values("WWW-Authenticate") {
+		challenge = strings.ToLower(strings.ReplaceAll(challenge, " ", ""))
+		if strings.Contains(challenge, `error="invalid_token"`) || strings.Contains(challenge, "error=invalid_token") {
+			return true
+		}
+	}
+	return false
+}
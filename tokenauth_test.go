@@ -0,0 +1,207 @@
+package httpretry
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTokenAuth(t *testing.T) {
+	check := assert.New(t)
+
+	newSource := func(calls *int32, delay time.Duration) TokenSource {
+		return func(ctx context.Context) (string, error) {
+			n := atomic.AddInt32(calls, 1)
+			time.Sleep(delay)
+			return "token-" + strconv.Itoa(int(n)), nil
+		}
+	}
+
+	t.Run("should fetch token on first use", func(t *testing.T) {
+		var calls int32
+		auth := NewTokenAuth(newSource(&calls, 0), false)
+
+		token, err := auth.Token(context.Background())
+		check.NoError(err)
+		check.Equal("token-1", token)
+
+		token, err = auth.Token(context.Background())
+		check.NoError(err)
+		check.Equal("token-1", token)
+		check.Equal(int32(1), calls)
+	})
+
+	t.Run("should not refresh already replaced token", func(t *testing.T) {
+		var calls int32
+		auth := NewTokenAuth(newSource(&calls, 0), false)
+
+		token, _ := auth.Refresh(context.Background(), "")
+		check.Equal("token-1", token)
+		token, _ = auth.Refresh(context.Background(), "token-1")
+		check.Equal("token-2", token)
+		token, _ = auth.Refresh(context.Background(), "token-1")
+		check.Equal("token-2", token)
+		check.Equal(int32(2), calls)
+	})
+
+	t.Run("should single-flight concurrent refreshes", func(t *testing.T) {
+		var calls int32
+		auth := NewTokenAuth(newSource(&calls, 20*time.Millisecond), false)
+		auth.token = "expired"
+
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				token, err := auth.Refresh(context.Background(), "expired")
+				check.NoError(err)
+				check.Equal("token-1", token)
+			}()
+		}
+		wg.Wait()
+
+		check.Equal(int32(1), calls)
+	})
+
+	t.Run("should not fail waiting callers if the first caller gives up", func(t *testing.T) {
+		release := make(chan struct{})
+		auth := NewTokenAuth(func(ctx context.Context) (string, error) {
+			<-release
+			return "token-1", ctx.Err()
+		}, false)
+
+		leaderCtx, cancel := context.WithCancel(context.Background())
+		leaderErr := make(chan error)
+		go func() {
+			_, err := auth.Refresh(leaderCtx, "")
+			leaderErr <- err
+		}()
+		// wait until the leader started the refresh
+		for auth.inFlight() == nil {
+			time.Sleep(time.Millisecond)
+		}
+
+		waiterToken := make(chan string)
+		go func() {
+			token, _ := auth.Refresh(context.Background(), "")
+			waiterToken <- token
+		}()
+
+		cancel()
+		check.ErrorIs(<-leaderErr, context.Canceled)
+
+		close(release)
+		check.Equal("token-1", <-waiterToken)
+	})
+
+	t.Run("should return error of token source", func(t *testing.T) {
+		auth := NewTokenAuth(func(ctx context.Context) (string, error) {
+			return "", errors.New("invalid grant")
+		}, false)
+
+		_, err := auth.Token(context.Background())
+		check.EqualError(err, "invalid grant")
+	})
+
+	t.Run("should detect rejected tokens", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "https://my-super-nonexisting-url.asd", nil)
+		unauthorized := FakeResponse(req, http.StatusUnauthorized, nil)
+		unauthorized.Header = http.Header{}
+		invalidToken := FakeResponse(req, http.StatusUnauthorized, nil)
+		invalidToken.Header = http.Header{"Www-Authenticate": []string{`Bearer realm="example", error="invalid_token"`}}
+
+		auth := NewTokenAuth(newSource(new(int32), 0), false)
+		check.True(auth.Rejected(unauthorized))
+		check.True(auth.Rejected(invalidToken))
+		check.False(auth.Rejected(FakeResponse(req, http.StatusForbidden, nil)))
+		check.False(auth.Rejected(nil))
+
+		auth = NewTokenAuth(newSource(new(int32), 0), true)
+		check.False(auth.Rejected(unauthorized))
+		check.True(auth.Rejected(invalidToken))
+	})
+}
+
+func TestRetryRoundtripperTokenAuth(t *testing.T) {
+	check := assert.New(t)
+
+	mockRoundtripper := &MockRoundtripper{}
+
+	var calls int32
+	retryRoundtripper := RetryRoundtripper{
+		MaxRetryCount:    3,
+		Next:             mockRoundtripper,
+		ShouldRetry:      (&MockRetryPolicy{}).ShouldRetry,
+		CalculateBackoff: (&MockBackoffPolicy{}).CalculateBackoff,
+		TokenAuth: NewTokenAuth(func(ctx context.Context) (string, error) {
+			return "token-" + strconv.Itoa(int(atomic.AddInt32(&calls, 1))), nil
+		}, false),
+	}
+
+	t.Run("should replay once with refreshed token", func(t *testing.T) {
+		var sentTokens []string
+		mockRoundtripper.RoundTripFunc = func(req *http.Request, called int) (response *http.Response, e error) {
+			sentTokens = append(sentTokens, req.Header.Get("Authorization"))
+			check.True(readerContains(t, req.Body, "body"))
+			if req.Header.Get("Authorization") == "Bearer token-1" {
+				return FakeResponse(req, http.StatusUnauthorized, []byte("unauthorized")), nil
+			}
+			return FakeResponse(req, 200, []byte("ok")), nil
+		}
+
+		req, _ := http.NewRequest("POST", "https://my-super-nonexisting-url.asd", strings.NewReader("body"))
+		res, err := retryRoundtripper.RoundTrip(req)
+
+		check.NoError(err)
+		check.Equal(200, res.StatusCode)
+		check.Equal([]string{"Bearer token-1", "Bearer token-2"}, sentTokens)
+		check.Empty(req.Header.Get("Authorization"))
+	})
+
+	t.Run("should replay only once and leave 401 to retry policy", func(t *testing.T) {
+		mockRoundtripper.reset()
+		mockRoundtripper.RoundTripFunc = func(req *http.Request, called int) (response *http.Response, e error) {
+			return FakeResponse(req, http.StatusUnauthorized, []byte("unauthorized")), nil
+		}
+
+		req, _ := http.NewRequest("GET", "https://my-super-nonexisting-url.asd", nil)
+		res, err := retryRoundtripper.RoundTrip(req)
+
+		check.NoError(err)
+		check.Equal(http.StatusUnauthorized, res.StatusCode)
+		check.Equal(2, mockRoundtripper.CallCount)
+	})
+
+	t.Run("should abort if refresh failed", func(t *testing.T) {
+		mockRoundtripper.reset()
+		mockRoundtripper.RoundTripFunc = func(req *http.Request, called int) (response *http.Response, e error) {
+			return FakeResponse(req, http.StatusUnauthorized, []byte("unauthorized")), nil
+		}
+		retryRoundtripper.TokenAuth = NewTokenAuth(func(ctx context.Context) (string, error) {
+			return "", errors.New("invalid grant")
+		}, false)
+		retryRoundtripper.TokenAuth.token = "expired"
+
+		req, _ := http.NewRequest("GET", "https://my-super-nonexisting-url.asd", nil)
+		res, err := retryRoundtripper.RoundTrip(req)
+
+		check.Nil(res)
+		check.EqualError(err, "invalid grant")
+		check.Equal(1, mockRoundtripper.CallCount)
+	})
+}
+
+// inFlight returns the running refresh.
+func (a *TokenAuth) inFlight() *tokenFlight {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.flight
+}
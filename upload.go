@@ -0,0 +1,343 @@
+package httpretry
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultChunkSize is the size of the uploaded chunks, if ChunkedUpload.ChunkSize is not set
+	defaultChunkSize = 8 << 20
+
+	// tusVersion is the version of the tus resumable upload protocol
+	tusVersion = "1.0.0"
+)
+
+// ChunkedUpload describes a resumable upload of Size bytes from Source.
+type ChunkedUpload struct {
+	Source io.ReaderAt
+	Size   int64
+
+	// ChunkSize is the maximum size of a single request body (default: 8 MiB)
+	ChunkSize int64
+
+	// Metadata is sent as Upload-Metadata when a tus upload is created (optional)
+	Metadata map[string]string
+}
+
+// UploadError is returned if a chunked upload failed and was not resumed anymore.
+type UploadError struct {
+	// Offset is the number of bytes that were confirmed by the server
+	Offset int64
+	// StatusCode of the last response, 0 if no response was received
+	StatusCode int
+	// Err is the error of the last request or why its response was rejected, nil if the response had a failure status
+	Err error
+}
+
+func (e *UploadError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("upload failed at offset %d: %v", e.Offset, e.Err)
+	}
+	return fmt.Sprintf("upload failed at offset %d with status code %d", e.Offset, e.StatusCode)
+}
+
+func (e *UploadError) Unwrap() error {
+	return e.Err
+}
+
+// UploadTus creates an upload at the tus endpoint (https://tus.io/protocols/resumable-upload) and uploads the source
+// in chunks. It returns the url of the created upload, which may be used to resume the upload with ResumeTus() later.
+//
+// After a failure, the offset of the server is queried and the upload resumes from there.
+// Failures are retried according to the retry policy, backoff policy and MaxRetryCount of the client's
+// retry roundtripper, a *UploadError is returned if the upload was not resumed anymore.
+// A chunk that is answered without progress counts as failure, a server offset that goes backwards aborts the upload.
+//
+// Example:
+//
+//	file, _ := os.Open("video.mp4")
+//	info, _ := file.Stat()
+//	uploadURL, err := httpretry.UploadTus(ctx, client, "https://example.com/files/", httpretry.ChunkedUpload{Source: file, Size: info.Size()})
+func UploadTus(ctx context.Context, client *http.Client, endpoint string, upload ChunkedUpload) (string, error) {
+	if client == nil {
+		panic("client must not be nil")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Tus-Resumable", tusVersion)
+	req.Header.Set("Upload-Length", strconv.FormatInt(upload.Size, 10))
+	if metadata := tusMetadata(upload.Metadata); metadata != "" {
+		req.Header.Set("Upload-Metadata", metadata)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	retryConfig(client).drainBody(resp)
+	if resp.StatusCode != http.StatusCreated {
+		return "", &UploadError{StatusCode: resp.StatusCode}
+	}
+
+	location, err := req.URL.Parse(resp.Header.Get("Location"))
+	if err != nil || resp.Header.Get("Location") == "" {
+		return "", errors.New("tus upload was created without a valid Location header")
+	}
+	uploadURL := location.String()
+
+	if upload.Size == 0 {
+		return uploadURL, nil
+	}
+	return uploadURL, uploadChunks(ctx, client, upload, &tusProtocol{uploadURL: uploadURL, size: upload.Size}, false)
+}
+
+// ResumeTus resumes an upload that was created with UploadTus(), starting at the offset of the server.
+func ResumeTus(ctx context.Context, client *http.Client, uploadURL string, upload ChunkedUpload) error {
+	if client == nil {
+		panic("client must not be nil")
+	}
+	return uploadChunks(ctx, client, upload, &tusProtocol{uploadURL: uploadURL, size: upload.Size}, true)
+}
+
+// UploadContentRange uploads the source in chunks with PUT requests and Content-Range headers
+// (e.g. resumable upload sessions of cloud storage providers).
+//
+// The server confirms received chunks with 308 and a Range header ("bytes=0-<last byte>"),
+// the completed upload with 200 or 201. After a failure, the offset of the server is queried with
+// "Content-Range: bytes */<size>" and the upload resumes from there, like UploadTus().
+func UploadContentRange(ctx context.Context, client *http.Client, uploadURL string, upload ChunkedUpload) error {
+	if client == nil {
+		panic("client must not be nil")
+	}
+	return uploadChunks(ctx, client, upload, &contentRangeProtocol{uploadURL: uploadURL, size: upload.Size}, false)
+}
+
+// uploadProtocol creates the requests of a resumable upload protocol and parses the responses.
+type uploadProtocol interface {
+	// chunkRequest returns the request that uploads the chunk at offset.
+	chunkRequest(ctx context.Context, offset int64, chunk *io.SectionReader) (*http.Request, error)
+	// offsetRequest returns the request that queries the offset of the server.
+	offsetRequest(ctx context.Context) (*http.Request, error)
+	// parseOffset returns the offset confirmed by the response of a chunk or offset request,
+	// ok is false if the response is not a success.
+	parseOffset(resp *http.Response) (offset int64, complete bool, ok bool)
+}
+
+// uploadChunks uploads the chunks and resumes after failures with the policies of the client's retry roundtripper.
+//
+// The requests are sent with disabled retries, since a failed chunk must not be replayed before the offset of
+// the server was queried.
+func uploadChunks(ctx context.Context, client *http.Client, upload ChunkedUpload, protocol uploadProtocol, queryOffset bool) error {
+	config := retryConfig(client)
+
+	chunkSize := upload.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = defaultChunkSize
+	}
+
+	var (
+		offset       int64
+		attemptCount = 1
+		requestCtx   = DisableRetries(ctx)
+	)
+	for {
+		var (
+			req *http.Request
+			err error
+		)
+		if queryOffset {
+			req, err = protocol.offsetRequest(requestCtx)
+		} else {
+			size := upload.Size - offset
+			if size > chunkSize {
+				size = chunkSize
+			}
+			req, err = protocol.chunkRequest(requestCtx, offset, io.NewSectionReader(upload.Source, offset, size))
+		}
+		if err != nil {
+			return err
+		}
+
+		var (
+			statusCode int
+			stalled    bool
+		)
+		resp, err := client.Do(req)
+		if err == nil {
+			statusCode = resp.StatusCode
+			newOffset, complete, ok := protocol.parseOffset(resp)
+			config.drainBody(resp)
+			if ok {
+				switch {
+				case complete:
+					return nil
+				case newOffset < offset:
+					// the server lost confirmed bytes, resuming would corrupt the upload
+					return &UploadError{
+						Offset:     offset,
+						StatusCode: statusCode,
+						Err:        fmt.Errorf("server offset %d is behind the confirmed offset %d", newOffset, offset),
+					}
+				case newOffset > offset:
+					// progress was made, so the failures start over
+					attemptCount = 1
+					offset, queryOffset = newOffset, false
+					continue
+				case queryOffset:
+					// the server confirmed the offset, continue with the next chunk
+					queryOffset = false
+					continue
+				}
+				// the chunk was answered without progress, which is handled like a failed chunk
+				stalled = true
+				err = fmt.Errorf("server did not confirm any bytes of the chunk at offset %d", offset)
+			}
+		}
+
+		// 409 Conflict: the offset of the server differs from the sent offset, so it must be queried
+		retry := stalled || statusCode == http.StatusConflict || config.ShouldRetry(statusCode, err)
+		if !retry || attemptCount > config.MaxRetryCount {
+			return &UploadError{Offset: offset, StatusCode: statusCode, Err: err}
+		}
+
+		timer := time.NewTimer(config.calculateBackoff(attemptCount, resp))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+
+		attemptCount++
+		queryOffset = true
+	}
+}
+
+// tusProtocol implements the core protocol of tus (https://tus.io/protocols/resumable-upload).
+type tusProtocol struct {
+	uploadURL string
+	size      int64
+}
+
+func (p *tusProtocol) chunkRequest(ctx context.Context, offset int64, chunk *io.SectionReader) (*http.Request, error) {
+	req, err := newChunkRequest(ctx, http.MethodPatch, p.uploadURL, chunk)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Tus-Resumable", tusVersion)
+	req.Header.Set("Upload-Offset", strconv.FormatInt(offset, 10))
+	req.Header.Set("Content-Type", "application/offset+octet-stream")
+	return req, nil
+}
+
+func (p *tusProtocol) offsetRequest(ctx context.Context) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, p.uploadURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Tus-Resumable", tusVersion)
+	req.Header.Set("Cache-Control", "no-store")
+	return req, nil
+}
+
+func (p *tusProtocol) parseOffset(resp *http.Response) (int64, bool, bool) {
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		return 0, false, false
+	}
+	offset, err := strconv.ParseInt(resp.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 || offset > p.size {
+		return 0, false, false
+	}
+	return offset, offset == p.size, true
+}
+
+// contentRangeProtocol implements resumable uploads with PUT requests and Content-Range headers.
+type contentRangeProtocol struct {
+	uploadURL string
+	size      int64
+}
+
+func (p *contentRangeProtocol) chunkRequest(ctx context.Context, offset int64, chunk *io.SectionReader) (*http.Request, error) {
+	if chunk.Size() == 0 {
+		return p.offsetRequest(ctx)
+	}
+	req, err := newChunkRequest(ctx, http.MethodPut, p.uploadURL, chunk)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", offset, offset+chunk.Size()-1, p.size))
+	return req, nil
+}
+
+func (p *contentRangeProtocol) offsetRequest(ctx context.Context) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, p.uploadURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Range", fmt.Sprintf("bytes */%d", p.size))
+	return req, nil
+}
+
+func (p *contentRangeProtocol) parseOffset(resp *http.Response) (int64, bool, bool) {
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusCreated:
+		return p.size, true, true
+	case http.StatusPermanentRedirect:
+		// "Resume Incomplete", the Range header contains the received bytes
+		received := resp.Header.Get("Range")
+		if received == "" {
+			return 0, false, true
+		}
+		last, ok := cutPrefix(received, "bytes=0-")
+		if !ok {
+			return 0, false, false
+		}
+		end, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || end < 0 || end >= p.size {
+			return 0, false, false
+		}
+		return end + 1, false, true
+	default:
+		return 0, false, false
+	}
+}
+
+// newChunkRequest returns a request with the chunk as replayable body.
+func newChunkRequest(ctx context.Context, method string, uploadURL string, chunk *io.SectionReader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, uploadURL, io.NewSectionReader(chunk, 0, chunk.Size()))
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = chunk.Size()
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(io.NewSectionReader(chunk, 0, chunk.Size())), nil
+	}
+	return req, nil
+}
+
+// tusMetadata encodes the metadata for the Upload-Metadata header.
+func tusMetadata(metadata map[string]string) string {
+	keys := make([]string, 0, len(metadata))
+	for key := range metadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, len(keys))
+	for i, key := range keys {
+		pairs[i] = key + " " + base64.StdEncoding.EncodeToString([]byte(metadata[key]))
+	}
+	return strings.Join(pairs, ",")
+}
@@ -0,0 +1,250 @@
+package httpretry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// uploadServer stores uploaded chunks, the second chunk request only stores half of the chunk and fails.
+type uploadServer struct {
+	mu       sync.Mutex
+	data     []byte
+	requests []string
+	chunks   int
+}
+
+// receive stores the chunk at offset, it returns false if the request should fail.
+func (s *uploadServer) receive(offset int64, body io.Reader) (int, bool) {
+	chunk, _ := io.ReadAll(body)
+	if offset != int64(len(s.data)) {
+		return http.StatusConflict, false
+	}
+	s.chunks++
+	if s.chunks == 2 {
+		s.data = append(s.data, chunk[:len(chunk)/2]...)
+		return http.StatusInternalServerError, false
+	}
+	s.data = append(s.data, chunk...)
+	return 0, true
+}
+
+func (s *uploadServer) tusHandler(size int64) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.requests = append(s.requests, r.Method)
+
+		if r.Header.Get("Tus-Resumable") != tusVersion {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodPost:
+			w.Header().Set("Location", "/files/1")
+			w.WriteHeader(http.StatusCreated)
+		case http.MethodHead:
+			w.Header().Set("Upload-Offset", strconv.Itoa(len(s.data)))
+			w.Header().Set("Upload-Length", strconv.FormatInt(size, 10))
+		case http.MethodPatch:
+			offset, _ := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+			if status, ok := s.receive(offset, r.Body); !ok {
+				w.WriteHeader(status)
+				return
+			}
+			w.Header().Set("Upload-Offset", strconv.Itoa(len(s.data)))
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}
+}
+
+func (s *uploadServer) contentRangeHandler(size int64) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		contentRange := r.Header.Get("Content-Range")
+		s.requests = append(s.requests, contentRange)
+
+		if !strings.HasPrefix(contentRange, "bytes */") {
+			var start, end int64
+			fmt.Sscanf(contentRange, "bytes %d-%d/", &start, &end)
+			if status, ok := s.receive(start, r.Body); !ok {
+				w.WriteHeader(status)
+				return
+			}
+		}
+
+		if int64(len(s.data)) == size {
+			w.WriteHeader(http.StatusCreated)
+			return
+		}
+		if len(s.data) > 0 {
+			w.Header().Set("Range", "bytes=0-"+strconv.Itoa(len(s.data)-1))
+		}
+		w.WriteHeader(http.StatusPermanentRedirect)
+	}
+}
+
+func TestUpload(t *testing.T) {
+	check := assert.New(t)
+
+	content := strings.Repeat("0123456789", 10)
+	upload := ChunkedUpload{
+		Source:    strings.NewReader(content),
+		Size:      int64(len(content)),
+		ChunkSize: 40,
+		Metadata:  map[string]string{"filename": "numbers.txt"},
+	}
+
+	client := NewDefaultClient(WithBackoffPolicy(ConstantBackoff(time.Millisecond, 0)))
+
+	t.Run("should upload with tus and resume at server offset", func(t *testing.T) {
+		server := &uploadServer{}
+		httpServer := httptest.NewServer(server.tusHandler(upload.Size))
+		defer httpServer.Close()
+
+		uploadURL, err := UploadTus(context.Background(), client, httpServer.URL+"/files/", upload)
+
+		check.NoError(err)
+		check.Equal(httpServer.URL+"/files/1", uploadURL)
+		check.Equal(content, string(server.data))
+		check.Equal([]string{"POST", "PATCH", "PATCH", "HEAD", "PATCH"}, server.requests)
+	})
+
+	t.Run("should resume tus upload", func(t *testing.T) {
+		server := &uploadServer{data: []byte(content[:30]), chunks: 2}
+		httpServer := httptest.NewServer(server.tusHandler(upload.Size))
+		defer httpServer.Close()
+
+		err := ResumeTus(context.Background(), client, httpServer.URL+"/files/1", upload)
+
+		check.NoError(err)
+		check.Equal(content, string(server.data))
+		check.Equal([]string{"HEAD", "PATCH", "PATCH"}, server.requests)
+	})
+
+	t.Run("should upload with content range and resume at server offset", func(t *testing.T) {
+		server := &uploadServer{}
+		httpServer := httptest.NewServer(server.contentRangeHandler(upload.Size))
+		defer httpServer.Close()
+
+		err := UploadContentRange(context.Background(), client, httpServer.URL, upload)
+
+		check.NoError(err)
+		check.Equal(content, string(server.data))
+		check.Equal([]string{
+			"bytes 0-39/100",
+			"bytes 40-79/100",
+			"bytes */100",
+			"bytes 60-99/100",
+		}, server.requests)
+	})
+
+	t.Run("should return upload error if not retryable", func(t *testing.T) {
+		httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusForbidden)
+		}))
+		defer httpServer.Close()
+
+		err := UploadContentRange(context.Background(), client, httpServer.URL, upload)
+
+		var uploadErr *UploadError
+		check.True(errors.As(err, &uploadErr))
+		check.Equal(http.StatusForbidden, uploadErr.StatusCode)
+		check.Equal(int64(0), uploadErr.Offset)
+	})
+
+	t.Run("should count chunks without progress as failures", func(t *testing.T) {
+		var requests int32
+		httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&requests, 1)
+			w.WriteHeader(http.StatusPermanentRedirect)
+		}))
+		defer httpServer.Close()
+
+		client := NewDefaultClient(WithMaxRetryCount(2), WithBackoffPolicy(ConstantBackoff(time.Millisecond, 0)))
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		err := UploadContentRange(ctx, client, httpServer.URL, upload)
+
+		var uploadErr *UploadError
+		check.True(errors.As(err, &uploadErr))
+		check.Equal(http.StatusPermanentRedirect, uploadErr.StatusCode)
+		check.ErrorContains(err, "did not confirm any bytes")
+		// chunk, (query offset, chunk) per retry
+		check.Equal(int32(5), atomic.LoadInt32(&requests))
+	})
+
+	t.Run("should reject server offset that goes backwards", func(t *testing.T) {
+		var requests int32
+		httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if atomic.AddInt32(&requests, 1) == 1 {
+				w.Header().Set("Range", "bytes=0-39")
+			} else {
+				w.Header().Set("Range", "bytes=0-9")
+			}
+			w.WriteHeader(http.StatusPermanentRedirect)
+		}))
+		defer httpServer.Close()
+
+		err := UploadContentRange(context.Background(), client, httpServer.URL, upload)
+
+		var uploadErr *UploadError
+		check.True(errors.As(err, &uploadErr))
+		check.Equal(int64(40), uploadErr.Offset)
+		check.ErrorContains(err, "behind the confirmed offset")
+		check.Equal(int32(2), atomic.LoadInt32(&requests))
+	})
+
+	t.Run("should give up after max retry count", func(t *testing.T) {
+		var requests int
+		httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		defer httpServer.Close()
+
+		client := NewDefaultClient(WithMaxRetryCount(2), WithBackoffPolicy(ConstantBackoff(time.Millisecond, 0)))
+		err := UploadContentRange(context.Background(), client, httpServer.URL, upload)
+
+		var uploadErr *UploadError
+		check.True(errors.As(err, &uploadErr))
+		check.Equal(http.StatusServiceUnavailable, uploadErr.StatusCode)
+		check.Equal(3, requests, "requests must not be retried by the roundtripper")
+	})
+}
+
+func TestDisableRetries(t *testing.T) {
+	check := assert.New(t)
+
+	mockRoundtripper := &MockRoundtripper{}
+	mockRoundtripper.RoundTripFunc = func(req *http.Request, called int) (response *http.Response, e error) {
+		return FakeResponse(req, 500, []byte("error")), nil
+	}
+
+	retryRoundtripper := RetryRoundtripper{
+		MaxRetryCount:    3,
+		Next:             mockRoundtripper,
+		ShouldRetry:      (&MockRetryPolicy{}).ShouldRetry,
+		CalculateBackoff: (&MockBackoffPolicy{}).CalculateBackoff,
+	}
+
+	req, _ := http.NewRequestWithContext(DisableRetries(context.Background()), "GET", "https://my-super-nonexisting-url.asd", nil)
+	res, err := retryRoundtripper.RoundTrip(req)
+
+	check.NoError(err)
+	check.Equal(500, res.StatusCode)
+	check.Equal(1, mockRoundtripper.CallCount)
+}